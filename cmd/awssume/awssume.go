@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"os/user"
 	"path"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/gkze/awssume/pkg/awssume"
 	"github.com/spf13/afero"
@@ -17,6 +24,21 @@ import (
 // errCurrentUser is returned when the current used cannot be determined
 const errCurrentUser string = "error determining current user: %w"
 
+// errInvalidConfig is returned when the configuration has the specified
+// number of problems
+const errInvalidConfig string = "configuration has %d problem(s)"
+
+// errShellDialect is returned when export statements cannot be printed for the
+// requested shell
+const errShellDialect string = "cannot print statements for shell %s: %w"
+
+// errNestedShell is returned when a shell is requested from within a Role
+// shell without --force
+const errNestedShell string = "%w (pass --force to start one anyway)"
+
+// ttyPath is the path of the controlling terminal device
+const ttyPath string = "/dev/tty"
+
 var (
 	// errTooFewArguments is returned when there are not enough arguments passed
 	errTooFewArguments error = errors.New("not enough arguments provided")
@@ -100,10 +122,12 @@ func main() {
 			cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
 				Fs:   afero.NewOsFs(),
 				Path: path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+				Lock: true,
 			})
 			if err != nil {
 				return fmt.Errorf(awssume.ErrNewConfig, err)
 			}
+			defer cfg.Close()
 
 			toRemove := strings.Join([]string{
 				cfg.GetPath(), cfg.GetFormat().String(),
@@ -127,12 +151,14 @@ func main() {
 		},
 	}
 
+	var added awssume.Role
+	var addPolicyFile string
 	addCmd := &cobra.Command{
 		Use:     "add [role] [alias] [session_name]",
 		Short:   "Add a new Role",
 		Aliases: []string{"a"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) > 3 {
+			if len(args) < 3 {
 				return errTooFewArguments
 			}
 
@@ -144,19 +170,311 @@ func main() {
 			cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
 				Fs:   afero.NewOsFs(),
 				Path: path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+				Lock: true,
 			})
 			if err != nil {
 				return fmt.Errorf(awssume.ErrNewConfig, err)
 			}
+			defer cfg.Close()
 
 			roleARN, err := awssume.ParseARN(args[0])
 			if err != nil {
 				return err
 			}
 
-			if err := cfg.AddRole(&awssume.Role{
-				ARN: &roleARN, Alias: args[1], SessionName: args[2],
-			}); err != nil {
+			added.ARN = &roleARN
+			added.Alias = args[1]
+			added.SessionName = args[2]
+
+			if addPolicyFile != "" {
+				if added.Policy, err = readPolicyFile(addPolicyFile); err != nil {
+					return err
+				}
+			}
+
+			if err := awssume.ValidatePolicyARNs(added.PolicyARNs); err != nil {
+				return err
+			}
+
+			if added.SessionDuration != 0 {
+				if err := awssume.ValidateSessionDuration(added.SessionDuration); err != nil {
+					return err
+				}
+			}
+
+			if err := awssume.ValidateEnv(added.Env); err != nil {
+				return err
+			}
+
+			if err := cfg.AddRole(&added); err != nil {
+				return err
+			}
+
+			return cfg.Save()
+		},
+	}
+
+	addCmd.PersistentFlags().StringVarP(
+		&added.ExternalID,
+		"external-id",
+		"e",
+		"",
+		"The External ID to pass when the Role is assumed",
+	)
+
+	addCmd.PersistentFlags().StringVarP(
+		&added.MFASerial,
+		"mfa-serial",
+		"m",
+		"",
+		"The serial number (or ARN) of the MFA device required to assume the Role",
+	)
+
+	addCmd.PersistentFlags().StringVarP(
+		&added.SourceRole,
+		"source",
+		"s",
+		"",
+		"The alias of a configured Role whose credentials are used to assume the Role",
+	)
+
+	addCmd.PersistentFlags().StringToStringVar(
+		&added.Tags,
+		"tag",
+		nil,
+		"A session tag to pass when the Role is assumed, as key=value (repeatable)",
+	)
+
+	addCmd.PersistentFlags().StringSliceVar(
+		&added.TransitiveTagKeys,
+		"transitive-tag-key",
+		nil,
+		"The key of a session tag that persists to Roles assumed from the Role's session (repeatable)",
+	)
+
+	addCmd.PersistentFlags().StringVar(
+		&addPolicyFile,
+		"policy-file",
+		"",
+		"A file containing an inline session policy that scopes down the Role's permissions",
+	)
+
+	addCmd.PersistentFlags().StringSliceVar(
+		&added.PolicyARNs,
+		"policy-arn",
+		nil,
+		"The ARN of a managed session policy that scopes down the Role's permissions (repeatable)",
+	)
+
+	addCmd.PersistentFlags().StringVar(
+		&added.SourceIdentity,
+		"source-identity",
+		"",
+		"The source identity template to pass when the Role is assumed, e.g. --source-identity={{.User}} (defaults to "+
+			awssume.DefaultSourceIdentity+" if the flag has no value)",
+	)
+	addCmd.PersistentFlags().Lookup("source-identity").NoOptDefVal = awssume.DefaultSourceIdentity
+
+	addCmd.PersistentFlags().Int32VarP(
+		&added.SessionDuration,
+		"session-duration",
+		"d",
+		0,
+		fmt.Sprintf(
+			"The default duration of the Role's STS Sessions, in seconds (default %d)",
+			awssume.DefaultSessionDuration,
+		),
+	)
+
+	addCmd.PersistentFlags().StringVar(
+		&added.Region,
+		"region",
+		"",
+		"The region to expose as $"+awssume.AWSRegionEnvVar+" alongside the Role's credentials",
+	)
+
+	addCmd.PersistentFlags().StringToStringVar(
+		&added.Env,
+		"env",
+		nil,
+		"An environment variable to expose alongside the Role's credentials, as key=value (repeatable)",
+	)
+
+	var assumeYes bool
+	removeCmd := &cobra.Command{
+		Use:     "remove [alias]",
+		Aliases: []string{"rm"},
+		Short:   "Remove a Role",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			alias := args[0]
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer cfg.Close()
+
+			r, err := cfg.GetRoleByAlias(alias)
+			if err != nil {
+				return err
+			}
+
+			if !assumeYes {
+				ok, err := confirm(fmt.Sprintf(
+					"Remove Role %s (%s)?", alias, r.GetARN().String(),
+				))
+				if err != nil || !ok {
+					return err
+				}
+			}
+
+			if err := cfg.RemoveRoleByAlias(alias); err != nil {
+				return err
+			}
+
+			return cfg.Save()
+		},
+	}
+
+	removeCmd.PersistentFlags().BoolVarP(
+		&assumeYes,
+		"yes",
+		"y",
+		false,
+		"Remove the Role without asking for confirmation",
+	)
+
+	renameCmd := &cobra.Command{
+		Use:     "rename [alias] [new_alias]",
+		Aliases: []string{"mv"},
+		Short:   "Rename a Role",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errTooFewArguments
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer cfg.Close()
+
+			if err := cfg.RenameRoleByAlias(args[0], args[1]); err != nil {
+				return err
+			}
+
+			return cfg.Save()
+		},
+	}
+
+	var update awssume.Role
+	var updateARN, updatePolicyFile string
+	updateCmd := &cobra.Command{
+		Use:     "update [alias]",
+		Aliases: []string{"u"},
+		Short:   "Update a Role",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			alias := args[0]
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer cfg.Close()
+
+			r, err := cfg.GetRoleByAlias(alias)
+			if err != nil {
+				return err
+			}
+
+			flags := cmd.Flags()
+			if flags.Changed("arn") {
+				roleARN, err := awssume.ParseARN(updateARN)
+				if err != nil {
+					return err
+				}
+
+				r.SetARN(&roleARN)
+			}
+
+			if flags.Changed("session-name") {
+				r.SetSessionName(update.SessionName)
+			}
+
+			if flags.Changed("external-id") {
+				r.SetExternalID(update.ExternalID)
+			}
+
+			if flags.Changed("mfa-serial") {
+				r.SetMFASerial(update.MFASerial)
+			}
+
+			if flags.Changed("source") {
+				r.SetSourceRole(update.SourceRole)
+			}
+
+			if flags.Changed("tag") {
+				r.SetTags(update.Tags)
+			}
+
+			if flags.Changed("transitive-tag-key") {
+				r.SetTransitiveTagKeys(update.TransitiveTagKeys)
+			}
+
+			if flags.Changed("source-identity") {
+				r.SetSourceIdentity(update.SourceIdentity)
+			}
+
+			if flags.Changed("policy-file") {
+				policy := ""
+				if updatePolicyFile != "" {
+					if policy, err = readPolicyFile(updatePolicyFile); err != nil {
+						return err
+					}
+				}
+
+				r.SetPolicy(policy)
+			}
+
+			if flags.Changed("policy-arn") {
+				if err := awssume.ValidatePolicyARNs(update.PolicyARNs); err != nil {
+					return err
+				}
+
+				r.SetPolicyARNs(update.PolicyARNs)
+			}
+
+			if flags.Changed("session-duration") {
+				if update.SessionDuration != 0 {
+					if err := awssume.ValidateSessionDuration(update.SessionDuration); err != nil {
+						return err
+					}
+				}
+
+				r.SetSessionDuration(update.SessionDuration)
+			}
+
+			if flags.Changed("region") {
+				r.SetRegion(update.Region)
+			}
+
+			if flags.Changed("env") {
+				if err := awssume.ValidateEnv(update.Env); err != nil {
+					return err
+				}
+
+				r.SetEnv(update.Env)
+			}
+
+			if err := cfg.UpdateRoleByAlias(alias, r); err != nil {
 				return err
 			}
 
@@ -164,7 +482,99 @@ func main() {
 		},
 	}
 
-	var sessionDuration int32
+	updateCmd.PersistentFlags().StringVar(
+		&updateARN, "arn", "", "The Role's ARN",
+	)
+
+	updateCmd.PersistentFlags().StringVar(
+		&update.SessionName, "session-name", "", "The STS Session name to use",
+	)
+
+	updateCmd.PersistentFlags().StringVarP(
+		&update.ExternalID,
+		"external-id",
+		"e",
+		"",
+		"The External ID to pass when the Role is assumed (empty to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringVarP(
+		&update.MFASerial,
+		"mfa-serial",
+		"m",
+		"",
+		"The serial number (or ARN) of the MFA device required to assume the Role (empty to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringVarP(
+		&update.SourceRole,
+		"source",
+		"s",
+		"",
+		"The alias of a configured Role whose credentials are used to assume the Role (empty to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringToStringVar(
+		&update.Tags,
+		"tag",
+		nil,
+		"A session tag to pass when the Role is assumed, as key=value (repeatable, replaces all tags)",
+	)
+
+	updateCmd.PersistentFlags().StringSliceVar(
+		&update.TransitiveTagKeys,
+		"transitive-tag-key",
+		nil,
+		"The key of a session tag that persists to Roles assumed from the Role's session (repeatable, replaces all keys)",
+	)
+
+	updateCmd.PersistentFlags().StringVar(
+		&updatePolicyFile,
+		"policy-file",
+		"",
+		"A file containing an inline session policy that scopes down the Role's permissions (empty to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringSliceVar(
+		&update.PolicyARNs,
+		"policy-arn",
+		nil,
+		"The ARN of a managed session policy that scopes down the Role's permissions (repeatable, replaces all ARNs)",
+	)
+
+	updateCmd.PersistentFlags().StringVar(
+		&update.SourceIdentity,
+		"source-identity",
+		"",
+		"The source identity template to pass when the Role is assumed (defaults to "+
+			awssume.DefaultSourceIdentity+" if the flag has no value, empty to unset)",
+	)
+	updateCmd.PersistentFlags().Lookup("source-identity").NoOptDefVal = awssume.DefaultSourceIdentity
+
+	updateCmd.PersistentFlags().Int32VarP(
+		&update.SessionDuration,
+		"session-duration",
+		"d",
+		0,
+		"The default duration of the Role's STS Sessions, in seconds (0 to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringVar(
+		&update.Region,
+		"region",
+		"",
+		"The region to expose as $"+awssume.AWSRegionEnvVar+" alongside the Role's credentials (empty to unset)",
+	)
+
+	updateCmd.PersistentFlags().StringToStringVar(
+		&update.Env,
+		"env",
+		nil,
+		"An environment variable to expose alongside the Role's credentials, as key=value (repeatable, replaces all variables)",
+	)
+
+	var execServe, execCredentialsFile bool
+	execFlags := &assumeFlags{}
 	execCmd := &cobra.Command{
 		Use:     "exec",
 		Aliases: []string{"e", "ex", "exe"},
@@ -177,14 +587,75 @@ func main() {
 			alias := args[0]
 
 			dashIdx := cmd.ArgsLenAtDash()
-			if dashIdx == -1 {
+			if dashIdx == -1 || len(args) < 2 {
 				return awssume.ErrCommandMissing
 			}
 
 			command := args[1]
-			arguments := []string{}
-			if len(args) > 1 {
-				arguments = args[2:]
+			arguments := args[2:]
+
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := execFlags.newConfig(curUser, alias)
+			if err != nil {
+				return err
+			}
+
+			if execServe {
+				err = cfg.ServeExecRole(alias, execFlags.sessionDuration, command, arguments)
+			} else if execCredentialsFile {
+				err = cfg.RefreshExecRole(alias, execFlags.sessionDuration, command, arguments)
+			} else {
+				err = cfg.ExecRole(alias, execFlags.sessionDuration, command, arguments)
+			}
+
+			// The command has already reported its own failure, if any
+			var exitErr *awssume.ExitError
+			if errors.As(err, &exitErr) {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+			}
+
+			return err
+		},
+	}
+
+	execCmd.PersistentFlags().BoolVar(
+		&execServe,
+		"serve",
+		false,
+		"Serve refreshing credentials to the subprocess from a local endpoint instead of static environment variables",
+	)
+
+	execCmd.PersistentFlags().BoolVar(
+		&execCredentialsFile,
+		"credentials-file",
+		false,
+		"Provide credentials to the subprocess through a shared credentials file that is rewritten before they expire",
+	)
+
+	execCmd.MarkFlagsMutuallyExclusive("serve", "credentials-file")
+
+	execFlags.register(execCmd)
+
+	var shellName string
+	envFlags := &assumeFlags{}
+	envCmd := &cobra.Command{
+		Use:   "env [alias]",
+		Short: "Print shell statements exporting Role credentials as environment variables",
+		Long: "Print shell statements exporting Role credentials as environment variables,\n" +
+			"to be evaluated by the current shell, e.g. eval \"$(awssume env someAlias)\"",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			dialect, err := shellDialect(shellName)
+			if err != nil {
+				return err
 			}
 
 			curUser, err := user.Current()
@@ -192,30 +663,933 @@ func main() {
 				return fmt.Errorf(errCurrentUser, err)
 			}
 
-			cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
-				Fs:   afero.NewOsFs(),
-				Path: path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+			cfg, err := envFlags.newConfig(curUser, args[0])
+			if err != nil {
+				return err
+			}
+
+			roleEnv, err := cfg.RoleEnv(args[0])
+			if err != nil {
+				return err
+			}
+
+			creds, err := cfg.AssumeRole(args[0], envFlags.sessionDuration)
+			if err != nil {
+				return err
+			}
+
+			exports, err := roleEnv.ShellExports(dialect)
+			if err != nil {
+				return err
+			}
+
+			credsExports, err := awssume.NewCredentialsEnvMap(creds).ShellExports(dialect)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Println(strings.Join(append(exports, credsExports...), "\n"))
+			return err
+		},
+	}
+
+	envCmd.PersistentFlags().StringVar(
+		&shellName,
+		"shell",
+		"",
+		"The shell to print statements for: bash, zsh, fish or powershell (default detected from $SHELL)",
+	)
+
+	envFlags.register(envCmd)
+
+	var serveAddr, serveShellName string
+	serveFlags := &assumeFlags{}
+	serveCmd := &cobra.Command{
+		Use:   "serve [alias]",
+		Short: "Serve Role credentials from a local container credentials endpoint",
+		Long: "Serve Role credentials from a local endpoint speaking the container credentials protocol,\n" +
+			"refreshing them before they expire, until interrupted. The printed shell statements point\n" +
+			"AWS SDKs at the endpoint.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			dialect, err := shellDialect(serveShellName)
+			if err != nil {
+				return err
+			}
+
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := serveFlags.newConfig(curUser, args[0])
+			if err != nil {
+				return err
+			}
+
+			srv, err := awssume.NewCredentialsServer(&awssume.NewCredentialsServerOpts{
+				Provider: awssume.NewRoleCredentialsProvider(&awssume.NewRoleCredentialsProviderOpts{
+					Config:          cfg,
+					Alias:           args[0],
+					SessionDuration: serveFlags.sessionDuration,
+				}),
+				Addr: serveAddr,
 			})
 			if err != nil {
-				return fmt.Errorf(awssume.ErrNewConfig, err)
+				return err
 			}
+			defer srv.Close()
 
-			return cfg.ExecRole(alias, sessionDuration, command, arguments)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if _, err := srv.Retrieve(ctx); err != nil {
+				return err
+			}
+
+			exports, err := srv.Env().ShellExports(dialect)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fmt.Println(strings.Join(exports, "\n")); err != nil {
+				return err
+			}
+
+			go func() {
+				<-ctx.Done()
+				srv.Close()
+			}()
+
+			return srv.Serve()
 		},
 	}
 
-	execCmd.PersistentFlags().Int32VarP(
-		&sessionDuration,
-		"session-duration",
-		"d",
-		60*60,
-		"The duration of the STS Session when the Role is assumed",
+	serveCmd.PersistentFlags().StringVar(
+		&serveAddr,
+		"addr",
+		awssume.DefaultServerAddr,
+		"The address to listen on",
 	)
 
-	rootCmd.AddCommand(versionCmd, listCmd, convertCmd, addCmd, execCmd)
+	serveCmd.PersistentFlags().StringVar(
+		&serveShellName,
+		"shell",
+		"",
+		"The shell to print statements for: bash, zsh, fish or powershell (default detected from $SHELL)",
+	)
+
+	serveFlags.register(serveCmd)
+
+	credentialProcessFlags := &assumeFlags{}
+	credentialProcessCmd := &cobra.Command{
+		Use:   "credential-process [alias]",
+		Short: "Print Role credentials for use as an AWS SDK credential_process",
+		Long: "Print Role credentials in the format AWS SDKs and tools expect from a credential_process,\n" +
+			"e.g. credential_process = awssume credential-process someAlias in ~/.aws/config",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := credentialProcessFlags.newConfig(curUser, args[0])
+			if err != nil {
+				return err
+			}
+
+			creds, err := cfg.AssumeRole(args[0], credentialProcessFlags.sessionDuration)
+			if err != nil {
+				return err
+			}
+
+			out, err := json.MarshalIndent(
+				awssume.NewCredentialProcessOutput(creds),
+				"",
+				strings.Repeat(" ", awssume.DefaultIndent),
+			)
+			if err != nil {
+				return fmt.Errorf(awssume.ErrMarshal, err)
+			}
+
+			_, err = fmt.Println(string(out))
+			return err
+		},
+	}
+
+	credentialProcessFlags.register(credentialProcessCmd)
+
+	var writeProfileName, writeProfileFile string
+	var writeProfileForce, writeProfileCleanup bool
+	writeProfileFlags := &assumeFlags{}
+	writeProfileCmd := &cobra.Command{
+		Use:   "write-profile [alias]",
+		Short: "Write Role credentials to a profile in the shared AWS credentials file",
+		Long: "Write Role credentials to a profile, named by the alias unless --profile is passed, in the\n" +
+			"shared AWS credentials file, leaving other profiles and comments untouched. Profiles not\n" +
+			"written by awssume are only overwritten with --force. With --cleanup-expired, profiles\n" +
+			"written by awssume whose credentials expired are removed; the alias is then optional.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !writeProfileCleanup {
+				return errTooFewArguments
+			}
+
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			file := awsCredentialsFilePath(curUser, writeProfileFile)
+
+			if len(args) > 0 {
+				profile := writeProfileName
+				if profile == "" {
+					profile = args[0]
+				}
+
+				// Check the profile up front, so that the Role is not assumed in
+				// vain
+				if !writeProfileForce {
+					data, err := os.ReadFile(file)
+					if err != nil && !errors.Is(err, os.ErrNotExist) {
+						return fmt.Errorf(awssume.ErrReadingFile, file, err)
+					}
+
+					if err := awssume.CheckCredentialsProfile(data, profile); err != nil {
+						return err
+					}
+				}
+
+				cfg, err := writeProfileFlags.newConfig(curUser, args[0])
+				if err != nil {
+					return err
+				}
+
+				creds, err := cfg.AssumeRole(args[0], writeProfileFlags.sessionDuration)
+				if err != nil {
+					return err
+				}
+
+				if err := awssume.WriteCredentialsProfile(file, profile, creds, writeProfileForce); err != nil {
+					return err
+				}
+			}
+
+			if writeProfileCleanup {
+				removed, err := awssume.CleanupCredentialsProfiles(file, time.Now())
+				if err != nil {
+					return err
+				}
+
+				for _, profile := range removed {
+					fmt.Printf("Removed expired profile %s\n", profile)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	writeProfileCmd.PersistentFlags().StringVar(
+		&writeProfileName,
+		"profile",
+		"",
+		"The profile to write the credentials to (default the alias)",
+	)
+
+	writeProfileCmd.PersistentFlags().StringVar(
+		&writeProfileFile,
+		"file",
+		"",
+		"The shared AWS credentials file to write to (default $"+
+			awssume.AWSSharedCredentialsFileEnvVar+" or ~/"+awssume.DefaultAWSCredentialsFilePath+")",
+	)
+
+	writeProfileCmd.PersistentFlags().BoolVarP(
+		&writeProfileForce,
+		"force",
+		"f",
+		false,
+		"Overwrite the profile even if it was not written by awssume",
+	)
+
+	writeProfileCmd.PersistentFlags().BoolVar(
+		&writeProfileCleanup,
+		"cleanup-expired",
+		false,
+		"Remove profiles written by awssume whose credentials expired",
+	)
+
+	writeProfileFlags.register(writeProfileCmd)
+
+	shellOpts := &awssume.ShellRoleOpts{}
+	shellFlags := &assumeFlags{}
+	shellCmd := &cobra.Command{
+		Use:     "shell [alias]",
+		Aliases: []string{"sh"},
+		Short:   "Start an interactive shell with Role credentials as environment variables",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errTooFewArguments
+			}
+
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := shellFlags.newConfig(curUser, args[0])
+			if err != nil {
+				return err
+			}
+
+			err = cfg.ShellRole(args[0], shellFlags.sessionDuration, shellOpts)
+			if errors.Is(err, awssume.ErrShellNesting) {
+				return fmt.Errorf(errNestedShell, err)
+			}
+
+			// The shell has already reported its own failure, if any
+			var exitErr *awssume.ExitError
+			if errors.As(err, &exitErr) {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+			}
+
+			return err
+		},
+	}
+
+	shellCmd.PersistentFlags().BoolVarP(
+		&shellOpts.Force,
+		"force",
+		"f",
+		false,
+		"Start the shell even from within another Role shell",
+	)
+
+	shellCmd.PersistentFlags().BoolVar(
+		&shellOpts.Prompt,
+		"prompt",
+		false,
+		"Prefix the prompt of bash, zsh and fish with the Role alias",
+	)
+
+	shellFlags.register(shellCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache [command]",
+		Short: "Manage cached Role credentials",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cacheClearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached Role credentials",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			return newFileCache(curUser, nil).Clear()
+		},
+	}
+
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	configCmd := &cobra.Command{
+		Use:   "config [command]",
+		Short: "Manage the configuration file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	var migrateDryRun bool
+	configMigrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the configuration file to the current schema version",
+		Long: "Migrate the configuration file to the current schema version, backing up the previous\n" +
+			"file next to it. With --dry-run, the migrated configuration is printed instead.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer cfg.Close()
+
+			from := cfg.GetLoadedVersion()
+			pending := awssume.MigrationsFrom(from)
+			if len(pending) == 0 {
+				fmt.Printf("Configuration is already at version %d\n", from)
+				return nil
+			}
+
+			for _, m := range pending {
+				fmt.Fprintf(os.Stderr, "Version %d: %s\n", m.Version, m.Description)
+			}
+
+			if migrateDryRun {
+				data, err := cfg.Marshal()
+				if err != nil {
+					return err
+				}
+
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			if err := cfg.Save(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Migrated configuration from version %d to %d\n", from, awssume.ConfigVersion)
+
+			return nil
+		},
+	}
+
+	configMigrateCmd.PersistentFlags().BoolVar(
+		&migrateDryRun,
+		"dry-run",
+		false,
+		"Print the migrated configuration instead of saving it",
+	)
+
+	configValidateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration file for problems",
+		Long: "Check the configured Roles for problems that would prevent them from being assumed,\n" +
+			"printing each one and exiting with a non-zero status if there are any.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
+				Fs:   afero.NewOsFs(),
+				Path: path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+			})
+			if err != nil {
+				return fmt.Errorf(awssume.ErrNewConfig, err)
+			}
+
+			problems := cfg.Validate()
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+
+			if len(problems) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf(errInvalidConfig, len(problems))
+			}
+
+			return nil
+		},
+	}
+
+	configCmd.AddCommand(configMigrateCmd, configValidateCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import [command]",
+		Short: "Import Roles from other tools' configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	var importAWSConfigFile string
+	importAWSConfigCmd := &cobra.Command{
+		Use:   "aws-config",
+		Short: "Import Roles from profiles in the shared AWS config file",
+		Long: "Import a Role for every profile in the shared AWS config file that has a role_arn,\n" +
+			"aliased by the profile name. Profiles whose name is already a Role alias are skipped,\n" +
+			"and source profiles that are not imported as Roles along with them are dropped, both\n" +
+			"with a warning.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			file := awsConfigFilePath(curUser, importAWSConfigFile)
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf(awssume.ErrReadingFile, file, err)
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer cfg.Close()
+
+			imported, conflicts, unlinked, err := cfg.ImportAWSProfiles(awssume.ParseAWSConfig(data))
+			for _, alias := range conflicts {
+				fmt.Fprintf(os.Stderr, "Skipped profile %s: %s\n", alias, awssume.ErrAliasTaken)
+			}
+
+			for _, alias := range unlinked {
+				fmt.Fprintf(
+					os.Stderr,
+					"Dropped source profile of %s: %s\n",
+					alias,
+					awssume.ErrSourceProfileNotImported,
+				)
+			}
+
+			if len(imported) > 0 {
+				if saveErr := cfg.Save(); saveErr != nil {
+					return saveErr
+				}
+			}
+
+			for _, alias := range imported {
+				fmt.Printf("Imported Role %s\n", alias)
+			}
+
+			return err
+		},
+	}
+
+	importAWSConfigCmd.PersistentFlags().StringVar(
+		&importAWSConfigFile,
+		"file",
+		"",
+		"The shared AWS config file to import from (default $"+
+			awssume.AWSConfigFileEnvVar+" or ~/"+awssume.DefaultAWSConfigFilePath+")",
+	)
+
+	importCmd.AddCommand(importAWSConfigCmd)
+
+	exportCmd := &cobra.Command{
+		Use:   "export [command]",
+		Short: "Export Roles to other tools' configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	var exportAWSConfigFile, exportSourceProfile string
+	var exportWrite bool
+	exportAWSConfigCmd := &cobra.Command{
+		Use:   "aws-config",
+		Short: "Export Roles as profiles in the shared AWS config file",
+		Long: "Render a profile for every Role, named by its alias, to stdout, or merge them into\n" +
+			"the shared AWS config file with --write, leaving other profiles untouched. Session name\n" +
+			"templates are expanded once, on export: {{.Host}} and {{.Timestamp}} keep the values they\n" +
+			"had at that time, and a warning is printed for Roles that use them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			curUser, err := user.Current()
+			if err != nil {
+				return fmt.Errorf(errCurrentUser, err)
+			}
+
+			cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
+				Fs:           afero.NewOsFs(),
+				Path:         path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+				TemplateData: awssume.NewTemplateData(curUser),
+			})
+			if err != nil {
+				return fmt.Errorf(awssume.ErrNewConfig, err)
+			}
+
+			profiles, err := cfg.AWSProfiles(exportSourceProfile)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range cfg.GetRoles() {
+				if awssume.IsVolatileTemplate(r.GetSessionName()) {
+					fmt.Fprintf(
+						os.Stderr,
+						"Warning: the session name of Role %s is frozen on export: %s\n",
+						r.GetAlias(), r.GetSessionName(),
+					)
+				}
+			}
+
+			if !exportWrite {
+				_, err = os.Stdout.Write(awssume.RenderAWSConfig(profiles))
+				return err
+			}
+
+			return awssume.WriteAWSConfig(awsConfigFilePath(curUser, exportAWSConfigFile), profiles)
+		},
+	}
+
+	exportAWSConfigCmd.PersistentFlags().StringVar(
+		&exportAWSConfigFile,
+		"file",
+		"",
+		"The shared AWS config file to merge profiles into with --write (default $"+
+			awssume.AWSConfigFileEnvVar+" or ~/"+awssume.DefaultAWSConfigFilePath+")",
+	)
+
+	exportAWSConfigCmd.PersistentFlags().BoolVarP(
+		&exportWrite,
+		"write",
+		"w",
+		false,
+		"Merge the profiles into the shared AWS config file instead of printing them",
+	)
+
+	exportAWSConfigCmd.PersistentFlags().StringVar(
+		&exportSourceProfile,
+		"source-profile",
+		"default",
+		"The profile providing base credentials to Roles without a source Role",
+	)
+
+	exportCmd.AddCommand(exportAWSConfigCmd)
+
+	rootCmd.AddCommand(
+		versionCmd, listCmd, convertCmd, addCmd, removeCmd, renameCmd,
+		updateCmd, execCmd, envCmd, credentialProcessCmd, writeProfileCmd, serveCmd, shellCmd, cacheCmd,
+		configCmd, importCmd, exportCmd,
+	)
+
+	if err := rootCmd.Execute(); err != nil {
+		var exitErr *awssume.ExitError
+		if errors.As(err, &exitErr) {
+			exitErr.Propagate()
+		}
 
-	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+// shellDialect returns the dialect of the passed shell, or of the current
+// shell (falling back to bash) if none is passed
+func shellDialect(shellName string) (awssume.ShellDialect, error) {
+	var dialect awssume.ShellDialect
+	if shellName != "" {
+		dialect.FromName(shellName)
+	} else if shell, err := awssume.GetShell(); err == nil {
+		dialect.FromName(shell)
+	}
+
+	if dialect == awssume.UnknownShell {
+		if shellName != "" {
+			return dialect, fmt.Errorf(errShellDialect, shellName, awssume.ErrUnsupportedShell)
+		}
+
+		dialect = awssume.Bash
+	}
+
+	return dialect, nil
+}
+
+// loadConfig loads the current user's configuration for modification,
+// locking it until it is closed
+func loadConfig() (*awssume.Config, error) {
+	curUser, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf(errCurrentUser, err)
+	}
+
+	cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
+		Fs:   afero.NewOsFs(),
+		Path: path.Join(curUser.HomeDir, awssume.DefaultConfigFilePath),
+		Lock: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(awssume.ErrNewConfig, err)
+	}
+
+	return cfg, nil
+}
+
+// confirm asks the passed yes/no question on stderr and reads the answer
+// from stdin, defaulting to no
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// assumeFlags holds the flags shared by commands that assume Roles
+type assumeFlags struct {
+	sessionDuration int32
+	tokenCode       string
+	noCache         bool
+	cacheKeyFile    string
+	tags            map[string]string
+	policyFile      string
+	policyARNs      []string
+	sourceIdentity  string
+	region          string
+	env             map[string]string
+}
+
+// register adds the flags to the passed command
+func (af *assumeFlags) register(cmd *cobra.Command) {
+	cmd.PersistentFlags().Int32VarP(
+		&af.sessionDuration,
+		"session-duration",
+		"d",
+		0,
+		fmt.Sprintf(
+			"The duration of the STS Session when the Role is assumed, in seconds (default the Role's, or %d)",
+			awssume.DefaultSessionDuration,
+		),
+	)
+
+	cmd.PersistentFlags().StringVarP(
+		&af.tokenCode,
+		"token-code",
+		"t",
+		"",
+		"The MFA token code to use if the Role requires MFA (\"-\" reads it from stdin)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&af.noCache,
+		"no-cache",
+		false,
+		"Always assume the Role through STS instead of reusing cached credentials",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&af.cacheKeyFile,
+		"cache-key-file",
+		"",
+		"The key file used to encrypt cached credentials (default ~/"+
+			awssume.DefaultCacheKeyFilePath+", ignored if $"+
+			awssume.CachePassphraseEnvVar+" is set)",
+	)
+
+	cmd.PersistentFlags().StringToStringVar(
+		&af.tags,
+		"tag",
+		nil,
+		"An additional session tag to pass when the Role is assumed, as key=value (repeatable)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&af.policyFile,
+		"policy-file",
+		"",
+		"A file containing an inline session policy to use instead of the Role's",
+	)
+
+	cmd.PersistentFlags().StringSliceVar(
+		&af.policyARNs,
+		"policy-arn",
+		nil,
+		"The ARN of a managed session policy to use instead of the Role's (repeatable)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&af.sourceIdentity,
+		"source-identity",
+		"",
+		"A source identity template to use instead of the Role's",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&af.region,
+		"region",
+		"",
+		"The region to expose as $"+awssume.AWSRegionEnvVar+" instead of the Role's",
+	)
+
+	cmd.PersistentFlags().StringToStringVar(
+		&af.env,
+		"env",
+		nil,
+		"An additional environment variable to expose alongside the credentials, as key=value (repeatable)",
+	)
+}
+
+// newConfig loads the passed user's configuration, set up to assume the Role
+// with the passed alias as specified by the flags. Flags that override Role
+// attributes are applied to the loaded Role only, and are never saved.
+func (af *assumeFlags) newConfig(u *user.User, alias string) (*awssume.Config, error) {
+	var cache awssume.ICache
+	if !af.noCache {
+		cipher, err := newCacheCipher(u, af.cacheKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cache = newFileCache(u, cipher)
+	}
+
+	cfg, err := awssume.NewConfig(&awssume.NewConfigOpts{
+		Fs:            afero.NewOsFs(),
+		Path:          path.Join(u.HomeDir, awssume.DefaultConfigFilePath),
+		TokenProvider: newTokenProvider(af.tokenCode),
+		Cache:         cache,
+		TemplateData:  awssume.NewTemplateData(u),
+	})
+	if err != nil {
+		return nil, fmt.Errorf(awssume.ErrNewConfig, err)
+	}
+
+	r, err := cfg.GetRoleByAlias(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(af.tags) > 0 {
+		tags := map[string]string{}
+		for k, v := range r.GetTags() {
+			tags[k] = v
+		}
+
+		for k, v := range af.tags {
+			tags[k] = v
+		}
+
+		r.SetTags(tags)
+	}
+
+	if af.policyFile != "" {
+		policy, err := readPolicyFile(af.policyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		r.SetPolicy(policy)
+	}
+
+	if len(af.policyARNs) > 0 {
+		r.SetPolicyARNs(af.policyARNs)
+	}
+
+	if af.sourceIdentity != "" {
+		r.SetSourceIdentity(af.sourceIdentity)
+	}
+
+	if af.region != "" {
+		r.SetRegion(af.region)
+	}
+
+	if len(af.env) > 0 {
+		if err := awssume.ValidateEnv(af.env); err != nil {
+			return nil, err
+		}
+
+		env := map[string]string{}
+		for k, v := range r.GetEnv() {
+			env[k] = v
+		}
+
+		for k, v := range af.env {
+			env[k] = v
+		}
+
+		r.SetEnv(env)
+	}
+
+	return cfg, nil
+}
+
+// readPolicyFile reads the inline session policy in the passed file,
+// validating and compacting it
+func readPolicyFile(name string) (string, error) {
+	policy, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf(awssume.ErrReadingFile, name, err)
+	}
+
+	return awssume.CompactPolicy(string(policy))
+}
+
+// awsConfigFilePath returns the path of the shared AWS config file: the passed
+// one if any, otherwise the one named by the environment or the default one
+// in the passed user's home directory
+func awsConfigFilePath(u *user.User, file string) string {
+	if file != "" {
+		return file
+	}
+
+	if file := os.Getenv(awssume.AWSConfigFileEnvVar); file != "" {
+		return file
+	}
+
+	return path.Join(u.HomeDir, awssume.DefaultAWSConfigFilePath)
+}
+
+// awsCredentialsFilePath returns the path of the shared AWS credentials file:
+// the passed one if any, otherwise the one named by the environment or the
+// default one in the passed user's home directory
+func awsCredentialsFilePath(u *user.User, file string) string {
+	if file != "" {
+		return file
+	}
+
+	if file := os.Getenv(awssume.AWSSharedCredentialsFileEnvVar); file != "" {
+		return file
+	}
+
+	return path.Join(u.HomeDir, awssume.DefaultAWSCredentialsFilePath)
+}
+
+// newFileCache returns the credential cache stored in the passed user's home
+// directory, encrypted with the passed cipher
+func newFileCache(u *user.User, cipher awssume.ICipher) *awssume.FileCache {
+	return awssume.NewFileCache(&awssume.NewFileCacheOpts{
+		Fs:     afero.NewOsFs(),
+		Dir:    path.Join(u.HomeDir, awssume.DefaultCacheDirPath),
+		Cipher: cipher,
+	})
+}
+
+// newCacheCipher returns the cipher used to encrypt cached credentials. The
+// passphrase in the environment takes precedence; otherwise the passed key
+// file (or the default one in the user's home directory) is used, and
+// generated if it does not exist yet.
+func newCacheCipher(u *user.User, keyFile string) (awssume.ICipher, error) {
+	if passphrase := os.Getenv(awssume.CachePassphraseEnvVar); passphrase != "" {
+		return awssume.NewPassphraseCipher(passphrase)
+	}
+
+	if keyFile == "" {
+		keyFile = path.Join(u.HomeDir, awssume.DefaultCacheKeyFilePath)
+	}
+
+	fs := afero.NewOsFs()
+	if err := awssume.EnsureKeyFile(fs, keyFile); err != nil {
+		return nil, err
+	}
+
+	return awssume.NewKeyFileCipher(fs, keyFile)
+}
+
+// newTokenProvider returns an MFA TokenProvider for the passed --token-code
+// flag value. An empty value prompts on the controlling terminal (falling back
+// to stdin when there is none), "-" reads from stdin without prompting, and
+// anything else is used as the token code verbatim.
+func newTokenProvider(tokenCode string) awssume.TokenProvider {
+	switch tokenCode {
+	case "":
+		return awssume.TerminalTokenProvider(ttyPath, os.Stdin, os.Stderr)
+	case "-":
+		return awssume.ReaderTokenProvider(os.Stdin, nil)
+	default:
+		return awssume.StaticTokenProvider(tokenCode)
+	}
+}
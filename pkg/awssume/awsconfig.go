@@ -0,0 +1,304 @@
+package awssume
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultAWSConfigFilePath is the default filesystem path, relative to
+	// the user's home directory, of the shared AWS config file
+	DefaultAWSConfigFilePath string = ".aws/config"
+
+	// AWSConfigFileEnvVar is the environment variable that, when set, holds
+	// the path of the shared AWS config file
+	AWSConfigFileEnvVar string = "AWS_CONFIG_FILE"
+
+	// DefaultImportedSessionName is the session name template given to Roles
+	// imported from profiles that do not specify a role_session_name
+	DefaultImportedSessionName string = "awssume-{{.User}}"
+
+	// awsConfigDefaultProfile is the name of the profile used when none is
+	// specified
+	awsConfigDefaultProfile string = "default"
+
+	// awsConfigProfilePrefix prefixes profile names in shared AWS config file
+	// section headers, except for the default profile
+	awsConfigProfilePrefix string = "profile "
+)
+
+var (
+	// ErrSourceProfileNotImported is returned when an imported profile's
+	// source profile is not imported as a Role along with it, e.g. because
+	// it does not assume a Role, so it cannot become the Role's source Role
+	ErrSourceProfileNotImported error = errors.New(
+		"source profile is not imported as a Role, the default credential chain is used instead",
+	)
+
+	// ErrSelfSourceProfile is returned when an exported profile would be its
+	// own source profile, which AWS tools reject
+	ErrSelfSourceProfile error = errors.New("profile would be its own source profile")
+)
+
+// AWSProfile holds the Role assumption settings of a profile in the shared
+// AWS config file
+type AWSProfile struct {
+	// Name is the name of the profile
+	Name string
+
+	// RoleARN is the ARN of the Role the profile assumes, if any
+	RoleARN string
+
+	// RoleSessionName is the session name used when assuming the Role
+	RoleSessionName string
+
+	// SourceProfile is the name of the profile whose credentials are used
+	// to assume the Role
+	SourceProfile string
+
+	// ExternalID is the External ID passed when assuming the Role
+	ExternalID string
+
+	// MFASerial is the serial number (or ARN) of the MFA device to
+	// authenticate with when assuming the Role
+	MFASerial string
+}
+
+// ParseAWSConfig returns the profiles defined in the passed shared AWS config
+// file contents, in the order they appear
+func ParseAWSConfig(data []byte) []*AWSProfile {
+	profiles := []*AWSProfile{}
+
+	for _, s := range parseINI(data).sections[1:] {
+		name, ok := awsConfigProfileName(s.name)
+		if !ok {
+			continue
+		}
+
+		p := &AWSProfile{Name: name}
+		p.RoleARN, _ = s.get("role_arn")
+		p.RoleSessionName, _ = s.get("role_session_name")
+		p.SourceProfile, _ = s.get("source_profile")
+		p.ExternalID, _ = s.get("external_id")
+		p.MFASerial, _ = s.get("mfa_serial")
+
+		profiles = append(profiles, p)
+	}
+
+	return profiles
+}
+
+// settings returns the profile's Role assumption settings as shared AWS
+// config file keys and values, with empty values for unset settings
+func (p *AWSProfile) settings() [][2]string {
+	return [][2]string{
+		{"role_arn", p.RoleARN},
+		{"role_session_name", p.RoleSessionName},
+		{"source_profile", p.SourceProfile},
+		{"external_id", p.ExternalID},
+		{"mfa_serial", p.MFASerial},
+	}
+}
+
+// RenderAWSConfig renders the passed profiles as a shared AWS config file
+func RenderAWSConfig(profiles []*AWSProfile) []byte {
+	return MergeAWSConfig(nil, profiles)
+}
+
+// MergeAWSConfig merges the passed profiles into the passed shared AWS config
+// file contents. The Role assumption settings of profiles that already exist
+// are replaced, and their other settings are kept. Other profiles, sections
+// and comments are left untouched.
+func MergeAWSConfig(data []byte, profiles []*AWSProfile) []byte {
+	f := parseINI(data)
+
+	for _, p := range profiles {
+		sectionName := awsConfigSectionName(p.Name)
+
+		s := f.section(sectionName)
+		if s == nil {
+			s = f.addSection(sectionName)
+		}
+
+		for _, setting := range p.settings() {
+			if setting[1] == "" {
+				s.unset(setting[0])
+			} else {
+				s.set(setting[0], setting[1])
+			}
+		}
+	}
+
+	return f.bytes()
+}
+
+// WriteAWSConfig merges the passed profiles into the shared AWS config file
+// at path, as MergeAWSConfig does
+func WriteAWSConfig(path string, profiles []*AWSProfile) error {
+	return editFileAtomic(path, 0o600, func(data []byte) ([]byte, error) {
+		return MergeAWSConfig(data, profiles), nil
+	})
+}
+
+// awsConfigSectionName returns the name of the shared AWS config file
+// section that defines the profile with the passed name
+func awsConfigSectionName(profile string) string {
+	if profile == awsConfigDefaultProfile {
+		return profile
+	}
+
+	return awsConfigProfilePrefix + profile
+}
+
+// awsConfigProfileName returns the name of the profile defined by the shared
+// AWS config file section with the passed name, and false if the section
+// does not define a profile
+func awsConfigProfileName(section string) (string, bool) {
+	if section == awsConfigDefaultProfile {
+		return section, true
+	}
+
+	if !strings.HasPrefix(section, awsConfigProfilePrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(section, awsConfigProfilePrefix)), true
+}
+
+// volatileTemplateFields are the template values that differ between hosts or
+// invocations
+var volatileTemplateFields = []string{".Host", ".Timestamp"}
+
+// IsVolatileTemplate reports whether the passed Role attribute template
+// refers to values that differ between hosts or invocations, which are frozen
+// when the template is expanded once, e.g. into an exported profile
+func IsVolatileTemplate(text string) bool {
+	if !strings.Contains(text, "{{") {
+		return false
+	}
+
+	for _, field := range volatileTemplateFields {
+		if strings.Contains(text, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ImportAWSProfiles adds a Role, aliased by the profile name, for every passed
+// profile that assumes one. Profiles whose name is already taken by a Role
+// are skipped and returned as conflicts. A source profile is kept as the
+// Role's source Role only if it is imported along with it, since the base
+// credentials of a chain come from the default credential chain, and a Role
+// that already had the source profile's name need not have anything to do
+// with it. Imported profiles whose source profile was dropped are returned as
+// unlinked.
+func (c *Config) ImportAWSProfiles(
+	profiles []*AWSProfile,
+) (imported, conflicts, unlinked []string, err error) {
+	importing := map[string]bool{}
+	for _, p := range profiles {
+		if _, err := c.GetRoleByAlias(p.Name); err != nil {
+			importing[p.Name] = p.RoleARN != ""
+		}
+	}
+
+	for _, p := range profiles {
+		if p.RoleARN == "" {
+			continue
+		}
+
+		if !importing[p.Name] {
+			conflicts = append(conflicts, p.Name)
+			continue
+		}
+
+		roleARN, err := ParseARN(p.RoleARN)
+		if err != nil {
+			return imported, conflicts, unlinked, fmt.Errorf(ErrImportProfile, p.Name, err)
+		}
+
+		r := &Role{
+			Alias:       p.Name,
+			ARN:         &roleARN,
+			SessionName: p.RoleSessionName,
+			ExternalID:  p.ExternalID,
+			MFASerial:   p.MFASerial,
+		}
+
+		if r.SessionName == "" {
+			r.SessionName = DefaultImportedSessionName
+		}
+
+		dropped := false
+		if p.SourceProfile != "" {
+			if importing[p.SourceProfile] {
+				r.SourceRole = p.SourceProfile
+			} else {
+				dropped = true
+			}
+		}
+
+		if err := c.AddRole(r); err != nil {
+			return imported, conflicts, unlinked, fmt.Errorf(ErrImportProfile, p.Name, err)
+		}
+
+		imported = append(imported, p.Name)
+		if dropped {
+			unlinked = append(unlinked, p.Name)
+		}
+	}
+
+	return imported, conflicts, unlinked, nil
+}
+
+// AWSProfiles returns a shared AWS config file profile, named by its alias,
+// for every configured Role, in alias order. Session name templates are
+// expanded, since AWS tools use session names as-is, so values such as
+// {{.Host}} and {{.Timestamp}} are frozen at export time (see
+// IsVolatileTemplate). Roles without a source Role use sourceProfile for
+// their base credentials, so a Role aliased sourceProfile cannot be exported
+// unless it has a source Role.
+func (c *Config) AWSProfiles(sourceProfile string) ([]*AWSProfile, error) {
+	profiles := make([]*AWSProfile, 0, len(c.Roles))
+
+	for _, r := range c.GetRoles() {
+		sessionName, err := c.expandTemplate(r.GetSessionName())
+		if err != nil {
+			return nil, err
+		}
+
+		sessionName, err = SanitizeSessionName(sessionName)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &AWSProfile{
+			Name:            r.GetAlias(),
+			RoleARN:         r.GetARN().String(),
+			RoleSessionName: sessionName,
+			SourceProfile:   r.GetSourceRole(),
+			ExternalID:      r.GetExternalID(),
+			MFASerial:       r.GetMFASerial(),
+		}
+
+		if p.SourceProfile == "" {
+			p.SourceProfile = sourceProfile
+		}
+
+		if p.SourceProfile == p.Name {
+			return nil, fmt.Errorf(ErrExportProfile, p.Name, ErrSelfSourceProfile)
+		}
+
+		profiles = append(profiles, p)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	return profiles, nil
+}
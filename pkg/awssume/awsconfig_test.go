@@ -0,0 +1,223 @@
+package awssume
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAWSConfig = `[default]
+region = us-east-1
+
+[profile base]
+aws_access_key_id = AKIAbase
+
+[profile bastion]
+role_arn = arn:aws:iam::000000000000:role/bastion
+source_profile = base
+mfa_serial = arn:aws:iam::000000000000:mfa/skunk
+
+[profile workload]
+role_arn = arn:aws:iam::111111111111:role/workload
+role_session_name = skunk
+source_profile = bastion
+external_id = external
+
+[sso-session corp]
+sso_region = us-east-1
+`
+
+func TestParseAWSConfig(t *testing.T) {
+	assert.Equal(t, []*AWSProfile{
+		{Name: "default"},
+		{Name: "base"},
+		{
+			Name:          "bastion",
+			RoleARN:       "arn:aws:iam::000000000000:role/bastion",
+			SourceProfile: "base",
+			MFASerial:     "arn:aws:iam::000000000000:mfa/skunk",
+		},
+		{
+			Name:            "workload",
+			RoleARN:         "arn:aws:iam::111111111111:role/workload",
+			RoleSessionName: "skunk",
+			SourceProfile:   "bastion",
+			ExternalID:      "external",
+		},
+	}, ParseAWSConfig([]byte(testAWSConfig)))
+}
+
+func TestConfigImportAWSProfiles(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{}, &Role{Alias: "bastion", SessionName: "bastion"})
+
+	imported, conflicts, unlinked, err := cfg.ImportAWSProfiles(ParseAWSConfig([]byte(testAWSConfig)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"workload"}, imported)
+	assert.Equal(t, []string{"bastion"}, conflicts)
+	assert.Equal(t, []string{"workload"}, unlinked)
+
+	// The existing bastion Role is unrelated to the bastion profile
+	r, err := cfg.GetRoleByAlias("workload")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/workload", r.GetARN().String())
+	assert.Equal(t, "skunk", r.GetSessionName())
+	assert.Empty(t, r.GetSourceRole())
+	assert.Equal(t, "external", r.GetExternalID())
+
+	cfg = newTestConfig(t, &NewConfigOpts{})
+	imported, conflicts, unlinked, err = cfg.ImportAWSProfiles(ParseAWSConfig([]byte(testAWSConfig)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bastion", "workload"}, imported)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, []string{"bastion"}, unlinked)
+
+	r, err = cfg.GetRoleByAlias("workload")
+	assert.NoError(t, err)
+	assert.Equal(t, "bastion", r.GetSourceRole())
+
+	r, err = cfg.GetRoleByAlias("bastion")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultImportedSessionName, r.GetSessionName())
+	assert.Empty(t, r.GetSourceRole())
+	assert.Equal(t, "arn:aws:iam::000000000000:mfa/skunk", r.GetMFASerial())
+
+	_, _, _, err = cfg.ImportAWSProfiles([]*AWSProfile{{Name: "invalid", RoleARN: "invalid"}})
+	assert.EqualError(t, err, "error importing profile invalid: arn: invalid prefix")
+}
+
+func TestConfigAWSProfiles(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{
+		TemplateData: &TemplateData{User: "skunk", Host: "burrow"},
+	}, &Role{
+		Alias:       "bastion",
+		SessionName: "{{.User}} at {{.Host}}",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/skunk",
+	}, &Role{
+		Alias:       "workload",
+		SessionName: "skunk",
+		SourceRole:  "bastion",
+		ExternalID:  "external",
+	})
+
+	profiles, err := cfg.AWSProfiles("default")
+	assert.NoError(t, err)
+	assert.Equal(t, []*AWSProfile{
+		{
+			Name:            "bastion",
+			RoleARN:         "arn:aws:iam::000000000000:role/bastion",
+			RoleSessionName: "skunk-at-burrow",
+			SourceProfile:   "default",
+			MFASerial:       "arn:aws:iam::000000000000:mfa/skunk",
+		},
+		{
+			Name:            "workload",
+			RoleARN:         "arn:aws:iam::000000000000:role/workload",
+			RoleSessionName: "skunk",
+			SourceProfile:   "bastion",
+			ExternalID:      "external",
+		},
+	}, profiles)
+
+	assert.Equal(t, `[profile bastion]
+role_arn = arn:aws:iam::000000000000:role/bastion
+role_session_name = skunk-at-burrow
+source_profile = default
+mfa_serial = arn:aws:iam::000000000000:mfa/skunk
+
+[profile workload]
+role_arn = arn:aws:iam::000000000000:role/workload
+role_session_name = skunk
+source_profile = bastion
+external_id = external
+`, string(RenderAWSConfig(profiles)))
+
+	defaultARN, err := ParseARN("arn:aws:iam::000000000000:role/default")
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.AddRole(&Role{Alias: "default", ARN: &defaultARN, SessionName: "skunk"}))
+	_, err = cfg.AWSProfiles("default")
+	assert.ErrorIs(t, err, ErrSelfSourceProfile)
+
+	profiles, err = cfg.AWSProfiles("base")
+	assert.NoError(t, err)
+	assert.Equal(t, "base", profiles[1].SourceProfile)
+}
+
+func TestIsVolatileTemplate(t *testing.T) {
+	for text, expected := range map[string]bool{
+		"skunk":                    false,
+		"{{.User}}":                false,
+		".Host":                    false,
+		"{{.User}}-{{.Host}}":      true,
+		"skunk-{{ .Timestamp }}":   true,
+		"{{.User}}-{{.Timestamp}}": true,
+	} {
+		assert.Equal(t, expected, IsVolatileTemplate(text), text)
+	}
+}
+
+func TestWriteAWSConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aws", "config")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	assert.NoError(t, os.WriteFile(path, []byte("[default]\nregion = us-east-1\n"), 0o600))
+
+	assert.NoError(t, WriteAWSConfig(path, []*AWSProfile{{
+		Name:          "skunk",
+		RoleARN:       "arn:aws:iam::000000000000:role/skunk",
+		SourceProfile: "default",
+	}}))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "[default]\n"+
+		"region = us-east-1\n"+
+		"\n"+
+		"[profile skunk]\n"+
+		"role_arn = arn:aws:iam::000000000000:role/skunk\n"+
+		"source_profile = default\n",
+		string(data),
+	)
+}
+
+func TestMergeAWSConfig(t *testing.T) {
+	merged := MergeAWSConfig([]byte(testAWSConfig), []*AWSProfile{
+		{
+			Name:            "workload",
+			RoleARN:         "arn:aws:iam::111111111111:role/workload",
+			RoleSessionName: "badger",
+			SourceProfile:   "bastion",
+		},
+		{
+			Name:            "ferret",
+			RoleARN:         "arn:aws:iam::222222222222:role/ferret",
+			RoleSessionName: "ferret",
+			SourceProfile:   "default",
+		},
+	})
+
+	assert.Equal(t, `[default]
+region = us-east-1
+
+[profile base]
+aws_access_key_id = AKIAbase
+
+[profile bastion]
+role_arn = arn:aws:iam::000000000000:role/bastion
+source_profile = base
+mfa_serial = arn:aws:iam::000000000000:mfa/skunk
+
+[profile workload]
+role_arn = arn:aws:iam::111111111111:role/workload
+role_session_name = badger
+source_profile = bastion
+
+[sso-session corp]
+sso_region = us-east-1
+
+[profile ferret]
+role_arn = arn:aws:iam::222222222222:role/ferret
+role_session_name = ferret
+source_profile = default
+`, string(merged))
+}
@@ -2,21 +2,24 @@ package awssume
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"os/signal"
+	"os/user"
 	"path"
 	"sort"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 	"github.com/naoina/toml"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
@@ -42,19 +45,61 @@ var (
 
 	// ErrUnexpected is returned when an unexpected error occurs
 	ErrUnexpected error = errors.New("unexpected error occurred")
+
+	// ErrNoTokenProvider is returned when a Role requires MFA but no
+	// TokenProvider has been configured
+	ErrNoTokenProvider error = errors.New("role requires MFA but no token provider is configured")
+
+	// ErrInvalidTokenCode is returned when an MFA token code is not a six
+	// digit number
+	ErrInvalidTokenCode error = errors.New("MFA token code must be six digits")
+
+	// ErrAliasTaken is returned when a Role alias is already in use
+	ErrAliasTaken error = errors.New("alias is already in use")
+
+	// ErrInvalidSessionDuration is returned when a session duration is
+	// outside of the bounds STS accepts
+	ErrInvalidSessionDuration error = errors.New("session duration must be between 900 and 43200 seconds")
+
+	// ErrChainedSessionDuration is returned when a Role assumed with the
+	// credentials of another Role asks for a longer session than STS allows
+	// for chained Roles
+	ErrChainedSessionDuration error = errors.New("session duration of chained Roles must be at most 3600 seconds")
 )
 
 // errors
 const (
+	// ErrCacheGet is returned when cached credentials cannot be retrieved for
+	// the specified Role alias
+	ErrCacheGet string = "error reading cached credentials for %s: %w"
+
+	// ErrCacheSet is returned when credentials cannot be cached for the
+	// specified Role alias
+	ErrCacheSet string = "error caching credentials for %s: %w"
+
 	// ErrCheckFileExists is returned when error is encountered while checking
 	// for the existence of the specified format configuration file on the
 	// filesystem
 	ErrCheckFileExists string = "error occurred while checking for %s configuration file existence: %w"
 
+	// ErrConfigVersion is returned when the configuration was written by a
+	// newer version of awssume, with a schema this version does not know
+	ErrConfigVersion string = "configuration version %d is newer than the supported version %d"
+
 	// ErrCreatingFile is returned when an error is encountered while creating
 	// the specified file
 	ErrCreatingFile string = "error creating file: %w"
 
+	// ErrCurrentUser is returned when the local user cannot be looked up
+	ErrCurrentUser string = "error getting current user: %w"
+
+	// ErrEncrypt is returned when an error is encountered while encrypting
+	ErrEncrypt string = "error encrypting: %w"
+
+	// ErrEnvVarName is returned when an environment variable name is not one
+	// that can be exported safely
+	ErrEnvVarName string = "invalid environment variable name %q: %w"
+
 	// ErrExecCmd is returned when an error is encountered while executing a
 	// passed command
 	ErrExecCmd string = "error executing command %s (args %s): %w"
@@ -63,19 +108,53 @@ const (
 	// be located in $PATH
 	ErrExeNotFound string = "executable %s not found: %w"
 
+	// ErrExportProfile is returned when the specified Role cannot be exported
+	// as a shared AWS config file profile
+	ErrExportProfile string = "error exporting Role %s as a profile: %w"
+
+	// ErrGenerateToken is returned when an authorization token cannot be
+	// generated
+	ErrGenerateToken string = "error generating authorization token: %w"
+
 	// ErrGetRoleByAlias is returned when the Role cannot be retrieved given its
 	// alias
 	ErrGetRoleByAlias string = "error getting Role for alias %s: %w"
 
+	// ErrImportProfile is returned when the specified shared AWS config file
+	// profile cannot be imported as a Role
+	ErrImportProfile string = "error importing profile %s: %w"
+
+	// ErrListen is returned when the specified address cannot be listened on
+	ErrListen string = "error listening on %s: %w"
+
 	// ErrLoadAWSConfig is returned when AWS configuration cannot be loaded
 	ErrLoadAWSConfig string = "error loading AWS config: %w"
 
+	// ErrLockFile is returned when the lock file at the specified path cannot
+	// be locked
+	ErrLockFile string = "error locking file %s: %w"
+
 	// ErrMarshal is returned when an error is encountered during serialization
 	ErrMarshal string = "error serializing: %w"
 
+	// ErrMigrateConfig is returned when the configuration cannot be migrated
+	// to the specified schema version
+	ErrMigrateConfig string = "error migrating configuration to version %d: %w"
+
+	// ErrNestedShell is returned when a shell is requested from within a
+	// shell already started for the specified Role alias
+	ErrNestedShell string = "already in a shell for Role %s: %w"
+
 	// ErrNewConfig is returned when a new aws.Config struct cannot be created
 	ErrNewConfig string = "error creating config: %w"
 
+	// ErrPolicyARN is returned when a managed session policy ARN is malformed
+	ErrPolicyARN string = "invalid session policy ARN %s: %w"
+
+	// ErrPolicyTooLong is returned when an inline session policy exceeds the
+	// size STS accepts
+	ErrPolicyTooLong string = "session policy is %d characters long, exceeding the limit of %d"
+
 	// ErrReadingFile is returned when an error reading a specified file is
 	// encountered
 	ErrReadingFile string = "error reading file %s: %w"
@@ -84,6 +163,16 @@ const (
 	// from a byte buffer
 	ErrReadingFromByteBuf string = "error reading from byte buffer: %w"
 
+	// ErrReadingTokenCode is returned when an MFA token code cannot be read
+	ErrReadingTokenCode string = "error reading MFA token code: %w"
+
+	// ErrRoleChainCycle is returned when following the source Roles of a Role
+	// leads back to a Role already in its chain
+	ErrRoleChainCycle string = "cycle detected in role chain: %s"
+
+	// ErrRoleChainHop is returned when a Role in a chain cannot be assumed
+	ErrRoleChainHop string = "error assuming Role %s (hop %d of %d in chain %s): %w"
+
 	// ErrRoleExists is returned when a specified Role already exists in the
 	// configuration
 	ErrRoleExists string = "role %s already exists: %w"
@@ -91,10 +180,34 @@ const (
 	// ErrRoleNotFound is returned when the specified file cannot be found
 	ErrRoleNotFound string = "no role with alias %s found"
 
+	// ErrSessionDuration is returned when the session duration requested
+	// for a Role is not one STS accepts
+	ErrSessionDuration string = "invalid session duration %d: %w"
+
+	// ErrSessionName is returned when the expanded session name of a Role is
+	// not one STS accepts
+	ErrSessionName string = "invalid session name %q: %w"
+
+	// ErrSourceIdentity is returned when the expanded source identity of a
+	// Role is not one STS accepts
+	ErrSourceIdentity string = "invalid source identity %q: %w"
+
 	// ErrSTSAssumeRole is returned when an error is encountered while
 	// performing the sts:AssumeRole operation
 	ErrSTSAssumeRole string = "error assuming Role %s: %w"
 
+	// ErrTemplate is returned when a Role attribute template cannot be
+	// expanded
+	ErrTemplate string = "error expanding template %s: %w"
+
+	// ErrTokenCode is returned when an MFA token code cannot be obtained for
+	// the specified MFA device
+	ErrTokenCode string = "error obtaining MFA token code for %s: %w"
+
+	// ErrTransitiveTagKey is returned when a transitive tag key does not name
+	// one of the Role's session tags
+	ErrTransitiveTagKey string = "transitive tag key %s is not a session tag"
+
 	// ErrUnmarshal is returned when an error is encountered during
 	// deserialization
 	ErrUnmarshal string = "error deserializing: %w"
@@ -103,6 +216,10 @@ const (
 	// deserialization of an ARN
 	ErrUnmarshalARN string = "error deserializing ARN: %w"
 
+	// ErrWriteProfile is returned when credentials cannot be written to the
+	// specified shared AWS credentials file profile
+	ErrWriteProfile string = "cannot write profile %s: %w"
+
 	// ErrWritingToFile is returned when an error is encountered while writing
 	// to a file
 	ErrWritingToFile string = "error writing to file %s: %w"
@@ -123,6 +240,12 @@ const (
 	// AWS Session Token is the STS Session Token received as part of an
 	// sts:AssumeRole API call
 	AWSSessionTokenEnvVar string = "AWS_SESSION_TOKEN"
+
+	// AWS Profile is the name of the shared configuration profile to use
+	AWSProfileEnvVar string = "AWS_PROFILE"
+
+	// AWS Region is the region AWS SDKs and tools send requests to
+	AWSRegionEnvVar string = "AWS_REGION"
 )
 
 // ConfigFormat describes the various supported configuration file formats
@@ -180,6 +303,24 @@ const (
 	// DefaultIndent is the default indentation to use when serializing into
 	// various formats
 	DefaultIndent int = 2
+
+	// CredentialsSource is the source reported on credentials obtained by
+	// assuming a Role
+	CredentialsSource string = "awssume"
+
+	// DefaultSessionDuration is the default duration of STS Sessions, in
+	// seconds
+	DefaultSessionDuration int32 = 60 * 60
+
+	// MinSessionDuration is the minimum duration of STS Sessions, in seconds
+	MinSessionDuration int32 = 15 * 60
+
+	// MaxSessionDuration is the maximum duration of STS Sessions, in seconds
+	MaxSessionDuration int32 = 12 * 60 * 60
+
+	// MaxChainedSessionDuration is the maximum duration of STS Sessions of
+	// Roles assumed with the credentials of another Role, in seconds
+	MaxChainedSessionDuration int32 = 60 * 60
 )
 
 // ARN is a wrapper around github.com/aws/aws-sdk-go-v2/aws/arn.ARN to allow
@@ -205,24 +346,38 @@ func (a *ARN) UnmarshalYAML(n *yaml.Node) error {
 }
 
 // MarshalJSON serializes to JSON by stringifying the ARN
-func (a *ARN) MarshalJSON() ([]byte, error) { return []byte(a.String()), nil }
+func (a *ARN) MarshalJSON() ([]byte, error) { return json.Marshal(a.String()) }
 
-// UnmarshalJSON deserializes the ARN from JSON by parsing it
+// UnmarshalJSON deserializes the ARN from a JSON string by parsing it
 func (a *ARN) UnmarshalJSON(bs []byte) error {
-	intermediate := struct {
-		Arn string `json:"arn"`
-	}{}
-	err := json.Unmarshal(bs, &intermediate)
-	*a, err = ParseARN(intermediate.Arn)
+	var s string
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return err
+	}
+
+	var err error
+	*a, err = ParseARN(s)
+	return err
+}
+
+// MarshalText serializes to text, e.g. a TOML string, by stringifying the ARN
+func (a *ARN) MarshalText() ([]byte, error) { return []byte(a.String()), nil }
+
+// UnmarshalText deserializes the ARN from text by parsing it
+func (a *ARN) UnmarshalText(bs []byte) error {
+	var err error
+	*a, err = ParseARN(string(bs))
 	return err
 }
 
 // Compile-time interface-implementation compatibility checks
 var (
-	_ json.Marshaler   = (*ARN)(nil)
-	_ json.Unmarshaler = (*ARN)(nil)
-	_ yaml.Marshaler   = (*ARN)(nil)
-	_ yaml.Unmarshaler = (*ARN)(nil)
+	_ json.Marshaler           = (*ARN)(nil)
+	_ json.Unmarshaler         = (*ARN)(nil)
+	_ yaml.Marshaler           = (*ARN)(nil)
+	_ yaml.Unmarshaler         = (*ARN)(nil)
+	_ encoding.TextMarshaler   = (*ARN)(nil)
+	_ encoding.TextUnmarshaler = (*ARN)(nil)
 )
 
 // IRole interface describes operations against IAM Roles
@@ -244,6 +399,88 @@ type IRole interface {
 
 	// SetRoleSessionName sets the Role's session name
 	SetSessionName(string)
+
+	// GetExternalID gets the Role's External ID
+	GetExternalID() string
+
+	// SetExternalID sets the Role's External ID
+	SetExternalID(string)
+
+	// GetMFASerial gets the Role's MFA device serial number (or ARN)
+	GetMFASerial() string
+
+	// SetMFASerial sets the Role's MFA device serial number (or ARN)
+	SetMFASerial(string)
+
+	// GetSourceRole gets the alias of the Role whose credentials are used to
+	// assume this Role
+	GetSourceRole() string
+
+	// SetSourceRole sets the alias of the Role whose credentials are used to
+	// assume this Role
+	SetSourceRole(string)
+
+	// GetTags gets the session tags passed when assuming the Role
+	GetTags() map[string]string
+
+	// SetTags sets the session tags passed when assuming the Role
+	SetTags(map[string]string)
+
+	// GetTransitiveTagKeys gets the keys of the session tags that persist to
+	// Roles assumed from the Role's session
+	GetTransitiveTagKeys() []string
+
+	// SetTransitiveTagKeys sets the keys of the session tags that persist to
+	// Roles assumed from the Role's session
+	SetTransitiveTagKeys([]string)
+
+	// GetPolicy gets the inline session policy that scopes down the Role's
+	// permissions
+	GetPolicy() string
+
+	// SetPolicy sets the inline session policy that scopes down the Role's
+	// permissions
+	SetPolicy(string)
+
+	// GetPolicyARNs gets the ARNs of the managed session policies that scope
+	// down the Role's permissions
+	GetPolicyARNs() []string
+
+	// SetPolicyARNs sets the ARNs of the managed session policies that scope
+	// down the Role's permissions
+	SetPolicyARNs([]string)
+
+	// GetSourceIdentity gets the source identity template passed when
+	// assuming the Role
+	GetSourceIdentity() string
+
+	// SetSourceIdentity sets the source identity template passed when
+	// assuming the Role
+	SetSourceIdentity(string)
+
+	// GetSessionDuration gets the default duration of the Role's STS
+	// Sessions, in seconds
+	GetSessionDuration() int32
+
+	// SetSessionDuration sets the default duration of the Role's STS
+	// Sessions, in seconds
+	SetSessionDuration(int32)
+
+	// GetRegion gets the region exposed to subprocesses given the Role's
+	// credentials
+	GetRegion() string
+
+	// SetRegion sets the region exposed to subprocesses given the Role's
+	// credentials
+	SetRegion(string)
+
+	// GetEnv gets the extra environment variables exposed to subprocesses
+	// given the Role's credentials
+	GetEnv() map[string]string
+
+	// SetEnv sets the extra environment variables exposed to subprocesses
+	// given the Role's credentials
+	SetEnv(map[string]string)
 }
 
 // IConfig interface describes operations against configuration source(s) for
@@ -261,9 +498,16 @@ type IConfig interface {
 	// SetFormat sets the configuraion format
 	SetFormat(ConfigFormat)
 
+	// GetLoadedVersion returns the schema version of the configuration as it
+	// was loaded, before it was migrated
+	GetLoadedVersion() int
+
 	// Save serializes the configuration to the filesystem
 	Save() error
 
+	// Close releases the configuration lock, if it is held
+	Close() error
+
 	// ListRoles returns a list of all configured Roles
 	GetRoles() []IRole
 
@@ -279,12 +523,65 @@ type IConfig interface {
 	// UpdateRoleByAlias updates the specified Role by its alias and the updated Role
 	UpdateRoleByAlias(string, IRole) error
 
+	// RenameRoleByAlias changes the alias of the specified Role, along with
+	// any references to it from other Roles
+	RenameRoleByAlias(alias, newAlias string) error
+
+	// GetRoleChain returns the Roles that have to be assumed in turn to assume
+	// the Role with the passed alias
+	GetRoleChain(string) ([]IRole, error)
+
+	// Validate returns the problems with the configured Roles that would
+	// prevent them from being assumed
+	Validate() []*ValidationError
+
+	// RoleEnv returns the environment variables configured for the Role with
+	// the passed alias, which are exposed alongside its credentials
+	RoleEnv(alias string) (*EnvMap, error)
+
+	// AssumeRole returns temporary credentials for the Role with the passed
+	// alias
+	AssumeRole(alias string, sessionDuration int32) (aws.Credentials, error)
+
+	// AssumeRoleWithContext returns temporary credentials for the Role with
+	// the passed alias, using the passed context for AWS API calls
+	AssumeRoleWithContext(
+		ctx context.Context, alias string, sessionDuration int32,
+	) (aws.Credentials, error)
+
 	// ExecRole allows executing subprocesses by assuming the target Role
 	// through STS and providing the resulting credentials as environment
 	// variables
 	ExecRole(alias string, sessionDuration int32, command string, args []string) error
+
+	// ShellRole starts an interactive shell with the credentials of the
+	// target Role provided as environment variables
+	ShellRole(alias string, sessionDuration int32, opts *ShellRoleOpts) error
+
+	// ServeExecRole executes a subprocess that obtains the credentials of the
+	// target Role from a local credentials server, which keeps them fresh
+	ServeExecRole(alias string, sessionDuration int32, command string, args []string) error
+
+	// RefreshExecRole executes a subprocess that reads the credentials of the
+	// target Role from a shared credentials file, which is kept fresh
+	RefreshExecRole(alias string, sessionDuration int32, command string, args []string) error
+}
+
+// IAssumer describes the sts:AssumeRole operation. It is implemented by
+// *sts.Client, and can be substituted to change how (or whether) STS is
+// called.
+type IAssumer interface {
+	// AssumeRole returns temporary security credentials for the Role
+	// specified in the input
+	AssumeRole(
+		ctx context.Context,
+		params *sts.AssumeRoleInput,
+		optFns ...func(*sts.Options),
+	) (*sts.AssumeRoleOutput, error)
 }
 
+var _ IAssumer = (*sts.Client)(nil)
+
 // Role struct implements the Role interface
 type Role struct {
 	// alias refers to a human-friendly Role identifier
@@ -294,8 +591,59 @@ type Role struct {
 	ARN *ARN `json:"arn" toml:"arn" yaml:"arn"`
 
 	// sessionName is the the string to use for the STS Session when assuming
-	// the target Role
+	// the target Role. It is a template expanded with TemplateData, e.g.
+	// {{.User}}-{{.Host}}-{{.Timestamp}}, and sanitized into a name STS
+	// accepts.
 	SessionName string `json:"session_name" toml:"session_name" yaml:"session_name"`
+
+	// ExternalID is the optional External ID to pass when assuming the target
+	// Role, as required by some third-party trust policies
+	ExternalID string `json:"external_id,omitempty" toml:"external_id,omitempty" yaml:"external_id,omitempty"`
+
+	// MFASerial is the optional serial number (or ARN) of the MFA device to
+	// authenticate with when assuming the target Role
+	MFASerial string `json:"mfa_serial,omitempty" toml:"mfa_serial,omitempty" yaml:"mfa_serial,omitempty"`
+
+	// SourceRole is the optional alias of another configured Role whose
+	// credentials are used to assume this Role, instead of the default
+	// credential chain
+	SourceRole string `json:"source,omitempty" toml:"source,omitempty" yaml:"source,omitempty"`
+
+	// Tags are the optional session tags passed when assuming the Role, e.g.
+	// for attribute-based access control
+	Tags map[string]string `json:"tags,omitempty" toml:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// TransitiveTagKeys are the keys of the session tags that persist to
+	// Roles assumed from the Role's session
+	TransitiveTagKeys []string `json:"transitive_tag_keys,omitempty" toml:"transitive_tag_keys,omitempty" yaml:"transitive_tag_keys,omitempty"`
+
+	// Policy is the optional inline session policy document passed when
+	// assuming the Role. The resulting credentials are limited to the
+	// intersection of the Role's permissions and the session policies
+	Policy string `json:"policy,omitempty" toml:"policy,omitempty" yaml:"policy,omitempty"`
+
+	// PolicyARNs are the optional ARNs of managed policies passed as session
+	// policies when assuming the Role
+	PolicyARNs []string `json:"policy_arns,omitempty" toml:"policy_arns,omitempty" yaml:"policy_arns,omitempty"`
+
+	// SourceIdentity is the optional source identity passed when assuming
+	// the Role, which CloudTrail records for every action taken with the
+	// resulting credentials. It is a template expanded with TemplateData,
+	// e.g. DefaultSourceIdentity.
+	SourceIdentity string `json:"source_identity,omitempty" toml:"source_identity,omitempty" yaml:"source_identity,omitempty"`
+
+	// SessionDuration is the optional default duration of the Role's STS
+	// Sessions, in seconds, used unless a duration is requested explicitly.
+	// DefaultSessionDuration is used if it is zero.
+	SessionDuration int32 `json:"session_duration,omitempty" toml:"session_duration,omitempty" yaml:"session_duration,omitempty"`
+
+	// Region is the optional region exposed as AWS_REGION to subprocesses
+	// given the Role's credentials
+	Region string `json:"region,omitempty" toml:"region,omitempty" yaml:"region,omitempty"`
+
+	// Env holds optional extra environment variables exposed to subprocesses
+	// given the Role's credentials
+	Env map[string]string `json:"env,omitempty" toml:"env,omitempty" yaml:"env,omitempty"`
 }
 
 // GetAlias returns the Role's alias
@@ -316,6 +664,72 @@ func (r *Role) GetSessionName() string { return r.SessionName }
 // SetSessionName sets the Role's STS Session Name
 func (r *Role) SetSessionName(sname string) { r.SessionName = sname }
 
+// GetExternalID gets the Role's External ID
+func (r *Role) GetExternalID() string { return r.ExternalID }
+
+// SetExternalID sets the Role's External ID
+func (r *Role) SetExternalID(externalID string) { r.ExternalID = externalID }
+
+// GetMFASerial gets the Role's MFA device serial number (or ARN)
+func (r *Role) GetMFASerial() string { return r.MFASerial }
+
+// SetMFASerial sets the Role's MFA device serial number (or ARN)
+func (r *Role) SetMFASerial(serial string) { r.MFASerial = serial }
+
+// GetSourceRole gets the alias of the Role used to assume this Role
+func (r *Role) GetSourceRole() string { return r.SourceRole }
+
+// SetSourceRole sets the alias of the Role used to assume this Role
+func (r *Role) SetSourceRole(alias string) { r.SourceRole = alias }
+
+// GetTags gets the Role's session tags
+func (r *Role) GetTags() map[string]string { return r.Tags }
+
+// SetTags sets the Role's session tags
+func (r *Role) SetTags(tags map[string]string) { r.Tags = tags }
+
+// GetTransitiveTagKeys gets the keys of the Role's transitive session tags
+func (r *Role) GetTransitiveTagKeys() []string { return r.TransitiveTagKeys }
+
+// SetTransitiveTagKeys sets the keys of the Role's transitive session tags
+func (r *Role) SetTransitiveTagKeys(keys []string) { r.TransitiveTagKeys = keys }
+
+// GetPolicy gets the Role's inline session policy
+func (r *Role) GetPolicy() string { return r.Policy }
+
+// SetPolicy sets the Role's inline session policy
+func (r *Role) SetPolicy(policy string) { r.Policy = policy }
+
+// GetPolicyARNs gets the ARNs of the Role's managed session policies
+func (r *Role) GetPolicyARNs() []string { return r.PolicyARNs }
+
+// SetPolicyARNs sets the ARNs of the Role's managed session policies
+func (r *Role) SetPolicyARNs(policyARNs []string) { r.PolicyARNs = policyARNs }
+
+// GetSourceIdentity gets the Role's source identity template
+func (r *Role) GetSourceIdentity() string { return r.SourceIdentity }
+
+// SetSourceIdentity sets the Role's source identity template
+func (r *Role) SetSourceIdentity(sourceIdentity string) { r.SourceIdentity = sourceIdentity }
+
+// GetSessionDuration gets the Role's default STS Session duration
+func (r *Role) GetSessionDuration() int32 { return r.SessionDuration }
+
+// SetSessionDuration sets the Role's default STS Session duration
+func (r *Role) SetSessionDuration(sessionDuration int32) { r.SessionDuration = sessionDuration }
+
+// GetRegion gets the Role's region
+func (r *Role) GetRegion() string { return r.Region }
+
+// SetRegion sets the Role's region
+func (r *Role) SetRegion(region string) { r.Region = region }
+
+// GetEnv gets the Role's extra environment variables
+func (r *Role) GetEnv() map[string]string { return r.Env }
+
+// SetEnv sets the Role's extra environment variables
+func (r *Role) SetEnv(env map[string]string) { r.Env = env }
+
 // Compile-time interface-implementation compatibility check
 var _ IRole = (*Role)(nil)
 
@@ -327,11 +741,49 @@ type Config struct {
 	// Format describes the current configuration format
 	Format ConfigFormat `json:"-" toml:"-" yaml:"-"`
 
+	// Version is the schema version of the configuration
+	Version int `json:"version" toml:"version" yaml:"version"`
+
 	// Roles holds all of the configured Roles
 	Roles []*Role `json:"roles" toml:"roles" yaml:"roles"`
 
 	// fs is an afero.Fs for filesystem operations
 	fs afero.Fs
+
+	// tokenProvider supplies MFA token codes for Roles that require them
+	tokenProvider TokenProvider
+
+	// cache stores assumed Role credentials between invocations
+	cache ICache
+
+	// assumer performs sts:AssumeRole calls
+	assumer IAssumer
+
+	// templateData holds the values Role attribute templates are expanded
+	// with
+	templateData *TemplateData
+
+	// lock is the configuration lock, if it is held
+	lock *fileLock
+
+	// loadedPath is the path of the file the configuration was loaded from
+	loadedPath string
+
+	// loadedSum is the checksum of the contents the configuration was loaded
+	// from, used to detect changes made by others before saving
+	loadedSum [sha256.Size]byte
+
+	// loadedVersion is the schema version of the contents the configuration
+	// was loaded from
+	loadedVersion int
+
+	// premigration holds the contents the configuration was loaded from if
+	// they were migrated, until they are backed up when it is saved
+	premigration []byte
+
+	// source holds the contents of the configuration file the Roles were
+	// decoded from, if it was not migrated, to locate them in it
+	source []byte
 }
 
 // GetPath returns the configuration filesystem path
@@ -346,8 +798,12 @@ func (c *Config) GetFormat() ConfigFormat { return c.Format }
 // SetFormat sets the configuraion format
 func (c *Config) SetFormat(format ConfigFormat) { c.Format = format }
 
-// Save serializes the configuration to the filesystem
-func (c *Config) Save() error {
+// GetLoadedVersion returns the schema version of the configuration file as
+// it was loaded, before it was migrated
+func (c *Config) GetLoadedVersion() int { return c.loadedVersion }
+
+// Marshal serializes the configuration in its format
+func (c *Config) Marshal() ([]byte, error) {
 	marshalFn := func(v interface{}) ([]byte, error) { return nil, nil }
 	switch c.GetFormat() {
 	case JSON:
@@ -360,14 +816,62 @@ func (c *Config) Save() error {
 
 	bytes, err := marshalFn(c)
 	if err != nil {
-		return fmt.Errorf(ErrMarshal, err)
+		return nil, fmt.Errorf(ErrMarshal, err)
 	}
 
-	return afero.WriteFile(
-		c.fs,
-		strings.Join([]string{c.GetPath(), c.GetFormat().String()}, "."),
-		bytes, os.FileMode(0o644),
-	)
+	return bytes, nil
+}
+
+// Save serializes the configuration to the filesystem. The file is written
+// atomically, readable by its owner only, and not at all if it was modified
+// by someone else since the configuration was loaded. If the configuration
+// was migrated, the file it was loaded from is backed up first.
+func (c *Config) Save() error {
+	bytes, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+
+	cfgPath := strings.Join([]string{c.GetPath(), c.GetFormat().String()}, ".")
+	if cfgPath == c.loadedPath {
+		sum, err := fileChecksum(c.fs, cfgPath)
+		if err != nil {
+			return err
+		}
+
+		if sum != c.loadedSum {
+			return fmt.Errorf(ErrWritingToFile, cfgPath, ErrConfigModified)
+		}
+	}
+
+	if c.premigration != nil {
+		backupPath := c.loadedPath + fmt.Sprintf(configBackupSuffix, c.loadedVersion)
+		if err := writeFileAtomic(c.fs, backupPath, c.premigration, os.FileMode(0o600)); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(c.fs, cfgPath, bytes, os.FileMode(0o600)); err != nil {
+		return err
+	}
+
+	c.premigration, c.source = nil, bytes
+
+	c.loadedPath, c.loadedSum = cfgPath, sha256.Sum256(bytes)
+
+	return nil
+}
+
+// Close releases the configuration lock, if it is held
+func (c *Config) Close() error {
+	if c.lock == nil {
+		return nil
+	}
+
+	err := c.lock.unlock()
+	c.lock = nil
+
+	return err
 }
 
 // GetRoles returns a list of all configured Roles
@@ -409,7 +913,7 @@ func (c *Config) RemoveRoleByAlias(alias string) error {
 func (c *Config) AddRole(r IRole) error {
 	existingRole, err := c.GetRoleByAlias(r.GetAlias())
 	if err == nil && existingRole != nil {
-		return fmt.Errorf(ErrRoleExists, r.GetAlias(), err)
+		return fmt.Errorf(ErrRoleExists, r.GetAlias(), ErrAliasTaken)
 	}
 
 	roles := append(c.Roles, r.(*Role))
@@ -435,70 +939,388 @@ func (c *Config) UpdateRoleByAlias(alias string, r IRole) error {
 	return nil
 }
 
+// RenameRoleByAlias changes the alias of the specified Role, along with any
+// references to it as a source Role from other Roles
+func (c *Config) RenameRoleByAlias(alias, newAlias string) error {
+	r, err := c.GetRoleByAlias(alias)
+	if err != nil {
+		return err
+	}
+
+	existingRole, err := c.GetRoleByAlias(newAlias)
+	if err == nil && existingRole != nil {
+		return fmt.Errorf(ErrRoleExists, newAlias, ErrAliasTaken)
+	}
+
+	r.SetAlias(newAlias)
+	for _, other := range c.Roles {
+		if other.GetSourceRole() == alias {
+			other.SetSourceRole(newAlias)
+		}
+	}
+
+	return nil
+}
+
+// GetRoleChain returns the Roles that have to be assumed in turn to assume
+// the Role with the passed alias, starting with the one assumed using the
+// default credential chain and ending with the Role itself
+func (c *Config) GetRoleChain(alias string) ([]IRole, error) {
+	chain := []IRole{}
+	walked := []string{}
+	seen := map[string]bool{}
+
+	for next := alias; next != ""; {
+		walked = append(walked, next)
+		if seen[next] {
+			return nil, fmt.Errorf(ErrRoleChainCycle, strings.Join(walked, " -> "))
+		}
+		seen[next] = true
+
+		r, err := c.GetRoleByAlias(next)
+		if err != nil {
+			return nil, fmt.Errorf(ErrGetRoleByAlias, next, err)
+		}
+
+		chain = append([]IRole{r}, chain...)
+		next = r.GetSourceRole()
+	}
+
+	return chain, nil
+}
+
+// RoleEnv returns the environment variables configured for the Role with the
+// passed alias, i.e. its extra environment variables and its region
+func (c *Config) RoleEnv(alias string) (*EnvMap, error) {
+	r, err := c.GetRoleByAlias(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for k, v := range r.GetEnv() {
+		env[k] = v
+	}
+
+	if region := r.GetRegion(); region != "" {
+		env[AWSRegionEnvVar] = region
+	}
+
+	return NewEnvMap(env), nil
+}
+
+// AssumeRole returns temporary credentials for the Role with the passed
+// alias. It is equivalent to AssumeRoleWithContext with a background context.
+func (c *Config) AssumeRole(alias string, sessionDuration int32) (aws.Credentials, error) {
+	return c.AssumeRoleWithContext(context.Background(), alias, sessionDuration)
+}
+
+// AssumeRoleWithContext returns temporary credentials for the Role with the
+// passed alias, walking its chain of source Roles if it has one. Cached
+// credentials are reused for any hop when a cache is configured and they have
+// not yet expired. A zero sessionDuration assumes every Role in the chain for
+// its own default duration.
+func (c *Config) AssumeRoleWithContext(
+	ctx context.Context,
+	alias string,
+	sessionDuration int32,
+) (aws.Credentials, error) {
+	chain, err := c.GetRoleChain(alias)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	durations, err := chainSessionDurations(chain, sessionDuration)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	// Start after the last hop that has usable cached credentials
+	var creds aws.Credentials
+	start := 0
+	if c.cache != nil {
+		for i := len(chain) - 1; i >= 0; i-- {
+			cached, err := c.cache.Get(CacheKey(chain[i], durations[i]))
+			if err != nil {
+				return aws.Credentials{}, fmt.Errorf(ErrCacheGet, chain[i].GetAlias(), err)
+			}
+
+			if cached != nil {
+				creds, start = *cached, i+1
+				break
+			}
+		}
+	}
+
+	if start == len(chain) {
+		return creds, nil
+	}
+
+	assumer := c.assumer
+	if assumer == nil {
+		awsCfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf(ErrLoadAWSConfig, err)
+		}
+
+		assumer = sts.NewFromConfig(awsCfg)
+	}
+
+	for i := start; i < len(chain); i++ {
+		r := chain[i]
+
+		optFns := []func(*sts.Options){}
+		if i > 0 {
+			srcCreds := creds
+			optFns = append(optFns, func(o *sts.Options) {
+				o.Credentials = aws.CredentialsProviderFunc(
+					func(context.Context) (aws.Credentials, error) { return srcCreds, nil },
+				)
+			})
+		}
+
+		creds, err = c.assumeRole(ctx, assumer, r, durations[i], optFns...)
+		if err != nil {
+			if len(chain) == 1 {
+				return aws.Credentials{}, err
+			}
+
+			return aws.Credentials{}, fmt.Errorf(
+				ErrRoleChainHop, r.GetAlias(), i+1, len(chain), roleChainString(chain), err,
+			)
+		}
+
+		if c.cache != nil {
+			if err := c.cache.Set(CacheKey(r, durations[i]), creds); err != nil {
+				return aws.Credentials{}, fmt.Errorf(ErrCacheSet, r.GetAlias(), err)
+			}
+		}
+	}
+
+	return creds, nil
+}
+
+// chainSessionDurations returns the session duration of every hop of the
+// passed Role chain. The passed session duration, if not zero, only applies
+// to the target Role, while the other hops use their own or the default. STS
+// caps the sessions of chained hops at MaxChainedSessionDuration, so
+// intermediate hops are clamped to it, and a target Role asking for more is
+// rejected.
+func chainSessionDurations(chain []IRole, sessionDuration int32) ([]int32, error) {
+	durations := make([]int32, len(chain))
+	for i, r := range chain {
+		duration := int32(0)
+		if i == len(chain)-1 {
+			duration = sessionDuration
+		}
+
+		if duration == 0 {
+			duration = r.GetSessionDuration()
+		}
+
+		if duration == 0 {
+			duration = DefaultSessionDuration
+		}
+
+		if err := ValidateSessionDuration(duration); err != nil {
+			return nil, err
+		}
+
+		if i > 0 && duration > MaxChainedSessionDuration {
+			if i == len(chain)-1 {
+				return nil, fmt.Errorf(ErrSessionDuration, duration, ErrChainedSessionDuration)
+			}
+
+			duration = MaxChainedSessionDuration
+		}
+
+		durations[i] = duration
+	}
+
+	return durations, nil
+}
+
+// assumeRole performs a single sts:AssumeRole call for the passed Role, with
+// the passed session duration
+func (c *Config) assumeRole(
+	ctx context.Context,
+	assumer IAssumer,
+	r IRole,
+	sessionDuration int32,
+	optFns ...func(*sts.Options),
+) (aws.Credentials, error) {
+	sessionName, err := c.expandTemplate(r.GetSessionName())
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	sessionName, err = SanitizeSessionName(sessionName)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	input := &sts.AssumeRoleInput{
+		DurationSeconds: aws.Int32(sessionDuration),
+		RoleArn:         aws.String(r.GetARN().String()),
+		RoleSessionName: aws.String(sessionName),
+	}
+
+	if externalID := r.GetExternalID(); externalID != "" {
+		input.ExternalId = aws.String(externalID)
+	}
+
+	if tags := r.GetTags(); len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		input.Tags = make([]types.Tag, len(keys))
+		for i, k := range keys {
+			input.Tags[i] = types.Tag{Key: aws.String(k), Value: aws.String(tags[k])}
+		}
+	}
+
+	if transitiveTagKeys := r.GetTransitiveTagKeys(); len(transitiveTagKeys) > 0 {
+		for _, k := range transitiveTagKeys {
+			if _, ok := r.GetTags()[k]; !ok {
+				return aws.Credentials{}, fmt.Errorf(ErrTransitiveTagKey, k)
+			}
+		}
+
+		input.TransitiveTagKeys = transitiveTagKeys
+	}
+
+	if policy := r.GetPolicy(); policy != "" {
+		compacted, err := CompactPolicy(policy)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+
+		input.Policy = aws.String(compacted)
+	}
+
+	if policyARNs := r.GetPolicyARNs(); len(policyARNs) > 0 {
+		if err := ValidatePolicyARNs(policyARNs); err != nil {
+			return aws.Credentials{}, err
+		}
+
+		input.PolicyArns = make([]types.PolicyDescriptorType, len(policyARNs))
+		for i, policyARN := range policyARNs {
+			input.PolicyArns[i] = types.PolicyDescriptorType{Arn: aws.String(policyARN)}
+		}
+	}
+
+	if sourceIdentity := r.GetSourceIdentity(); sourceIdentity != "" {
+		expanded, err := c.expandTemplate(sourceIdentity)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+
+		if err := ValidateSourceIdentity(expanded); err != nil {
+			return aws.Credentials{}, fmt.Errorf(ErrSourceIdentity, expanded, err)
+		}
+
+		input.SourceIdentity = aws.String(expanded)
+	}
+
+	if mfaSerial := r.GetMFASerial(); mfaSerial != "" {
+		if c.tokenProvider == nil {
+			return aws.Credentials{}, ErrNoTokenProvider
+		}
+
+		tokenCode, err := c.tokenProvider(mfaSerial)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf(ErrTokenCode, mfaSerial, err)
+		}
+
+		input.SerialNumber = aws.String(mfaSerial)
+		input.TokenCode = aws.String(tokenCode)
+	}
+
+	res, err := assumer.AssumeRole(ctx, input, optFns...)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf(ErrSTSAssumeRole, r.GetARN(), err)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(res.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(res.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(res.Credentials.SessionToken),
+		Source:          CredentialsSource,
+		CanExpire:       res.Credentials.Expiration != nil,
+		Expires:         aws.ToTime(res.Credentials.Expiration),
+	}, nil
+}
+
+// expandTemplate expands the passed Role attribute template, deriving the
+// template data from the current user if none was configured
+func (c *Config) expandTemplate(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	if c.templateData == nil {
+		u, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf(ErrCurrentUser, err)
+		}
+
+		c.templateData = NewTemplateData(u)
+	}
+
+	return ExpandTemplate(text, c.templateData)
+}
+
+// ValidateSessionDuration checks that the passed session duration is one STS
+// accepts
+func ValidateSessionDuration(sessionDuration int32) error {
+	if sessionDuration < MinSessionDuration || sessionDuration > MaxSessionDuration {
+		return fmt.Errorf(ErrSessionDuration, sessionDuration, ErrInvalidSessionDuration)
+	}
+
+	return nil
+}
+
+// roleChainString renders a Role chain as its aliases joined by arrows
+func roleChainString(chain []IRole) string {
+	aliases := make([]string, len(chain))
+	for i, r := range chain {
+		aliases[i] = r.GetAlias()
+	}
+
+	return strings.Join(aliases, " -> ")
+}
+
 // ExecRole allows executing subprocesses by assuming the target Role
-// through STS and providing the resulting credentials as environment
-// variables
+// through STS and providing the resulting credentials, along with the Role's
+// environment, as environment variables. If the subprocess does not exit
+// successfully, an *ExitError describing how it terminated is returned.
 func (c *Config) ExecRole(
 	alias string,
 	sessionDuration int32,
 	command string,
 	arguments []string,
 ) error {
-	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	roleEnv, err := c.RoleEnv(alias)
 	if err != nil {
-		return fmt.Errorf(ErrLoadAWSConfig, err)
-	}
-
-	resRole, err := c.GetRoleByAlias(alias)
-	if err != nil {
-		return fmt.Errorf(ErrGetRoleByAlias, alias, err)
+		return err
 	}
 
-	res, err := sts.NewFromConfig(awsCfg).AssumeRole(
-		context.Background(),
-		&sts.AssumeRoleInput{
-			DurationSeconds: aws.Int32(sessionDuration),
-			RoleArn:         aws.String(resRole.GetARN().String()),
-			RoleSessionName: aws.String(resRole.GetSessionName()),
-		},
-	)
+	creds, err := c.AssumeRole(alias, sessionDuration)
 	if err != nil {
-		return fmt.Errorf(ErrSTSAssumeRole, resRole.GetARN(), err)
+		return err
 	}
 
 	cmdToRun := exec.Command(command, arguments...)
 	cmdToRun.Stdin = os.Stdin
 	cmdToRun.Stdout = os.Stdout
 	cmdToRun.Stderr = os.Stderr
-	cmdToRun.Env = append(os.Environ(), (*NewEnvMap(map[string]string{
-		AWSAccessKeyIDEnvVar:      *res.Credentials.AccessKeyId,
-		AWSSecreteAccessKeyEnvVar: *res.Credentials.SecretAccessKey,
-		AWSSecurityTokenEnvVar:    *res.Credentials.SessionToken,
-		AWSSessionTokenEnvVar:     *res.Credentials.SessionToken,
-	})).StringSlice()...)
-
-	// Forward SIGINT, SIGTERM, SIGKILL to the child command
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
-
-	go func() {
-		sig := <-sigChan
-		if cmdToRun.Process != nil {
-			cmdToRun.Process.Signal(sig)
-		}
-	}()
-
-	var waitStatus syscall.WaitStatus
-	if err := cmdToRun.Run(); err != nil {
-		if err != nil {
-			return err
-		}
-		if exitError, ok := err.(*exec.ExitError); ok {
-			waitStatus = exitError.Sys().(syscall.WaitStatus)
-			os.Exit(waitStatus.ExitStatus())
-		}
-	}
-	return nil
+	cmdToRun.Env = append(os.Environ(), roleEnv.StringSlice()...)
+	cmdToRun.Env = append(cmdToRun.Env, NewCredentialsEnvMap(creds).StringSlice()...)
+
+	return RunCommand(cmdToRun)
 }
 
 var _ IConfig = (*Config)(nil)
@@ -507,14 +1329,75 @@ var _ IConfig = (*Config)(nil)
 type NewConfigOpts struct {
 	Fs   afero.Fs
 	Path string
+
+	// TokenProvider supplies MFA token codes for Roles that have an MFA
+	// serial configured. It may be left nil if no Role requires MFA.
+	TokenProvider TokenProvider
+
+	// Cache stores assumed Role credentials so they can be reused until they
+	// expire. It may be left nil to always call STS.
+	Cache ICache
+
+	// Assumer performs sts:AssumeRole calls. If it is nil, an STS client is
+	// created from the default AWS configuration when a Role is assumed.
+	Assumer IAssumer
+
+	// TemplateData holds the values Role attribute templates are expanded
+	// with. If it is nil, it is derived from the current user when a
+	// template is first expanded.
+	TemplateData *TemplateData
+
+	// Lock takes an exclusive advisory lock on the configuration, held until
+	// Close is called, so that concurrent read-modify-write cycles do not
+	// lose each other's changes. It only applies to the OS filesystem.
+	Lock bool
+
+	// LockTimeout is how long to wait for another process to release the
+	// lock. DefaultLockTimeout is used if it is zero.
+	LockTimeout time.Duration
 }
 
 // NewConfig parses a config object from a specified path
 func NewConfig(opts *NewConfigOpts) (*Config, error) {
+	var lock *fileLock
+	if _, ok := opts.Fs.(*afero.OsFs); ok && opts.Lock {
+		timeout := opts.LockTimeout
+		if timeout == 0 {
+			timeout = DefaultLockTimeout
+		}
+
+		var err error
+		lock, err = lockFile(strings.TrimSuffix(opts.Path, path.Ext(opts.Path))+lockFileSuffix, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		if lock != nil {
+			lock.unlock()
+		}
+
+		return nil, err
+	}
+
+	cfg.lock = lock
+
+	return cfg, nil
+}
+
+// loadConfig parses a config object from a specified path
+func loadConfig(opts *NewConfigOpts) (*Config, error) {
 	cfg := &Config{
 		Format: Unknown,
 		Path:   strings.TrimSuffix(opts.Path, path.Ext(opts.Path)),
 		fs:     opts.Fs,
+
+		tokenProvider: opts.TokenProvider,
+		cache:         opts.Cache,
+		assumer:       opts.Assumer,
+		templateData:  opts.TemplateData,
 	}
 
 	JSONFilePath := strings.Join([]string{cfg.GetPath(), JSON.String()}, ".")
@@ -556,7 +1439,7 @@ func NewConfig(opts *NewConfigOpts) (*Config, error) {
 	bytes, err := afero.ReadFile(cfg.fs, cfgPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			f, err := cfg.fs.Create(cfgPath)
+			f, err := cfg.fs.OpenFile(cfgPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
 			defer f.Close()
 
 			if err != nil {
@@ -567,6 +1450,8 @@ func NewConfig(opts *NewConfigOpts) (*Config, error) {
 		}
 	}
 
+	cfg.loadedPath, cfg.loadedSum = cfgPath, sha256.Sum256(bytes)
+
 	unmarshalFn := func(data []byte, target interface{}) error { return nil }
 	switch cfg.GetFormat() {
 	case JSON:
@@ -581,7 +1466,25 @@ func NewConfig(opts *NewConfigOpts) (*Config, error) {
 		return nil, ErrUnexpected
 	}
 
-	err = unmarshalFn(bytes, cfg)
+	// New configurations start out at the current schema version
+	if strings.TrimSpace(string(bytes)) == "" {
+		cfg.Version, cfg.loadedVersion = ConfigVersion, ConfigVersion
+		return cfg, nil
+	}
+
+	migrated, version, err := migrateConfig(bytes, cfg.GetFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.loadedVersion = version
+	if version != ConfigVersion {
+		cfg.premigration = bytes
+	} else {
+		cfg.source = bytes
+	}
+
+	err = unmarshalFn(migrated, cfg)
 	if err != nil {
 		return nil, fmt.Errorf(ErrUnmarshal, err)
 	}
@@ -590,9 +1493,10 @@ func NewConfig(opts *NewConfigOpts) (*Config, error) {
 }
 
 // IEnvMap describes a map of environment variables that can be transformed
-// to a string slice
+// to a string slice or to shell export statements
 type IEnvMap interface {
 	StringSlice() []string
+	ShellExports(ShellDialect) ([]string, error)
 }
 
 // EnvMap implements IEnvMap
@@ -615,6 +1519,17 @@ func (e *EnvMap) StringSlice() []string {
 // NewEnvMap creates a new EnvMap from a passed map
 func NewEnvMap(m map[string]string) *EnvMap { return &EnvMap{m: m} }
 
+// NewCredentialsEnvMap creates a new EnvMap holding the environment variables
+// that expose the passed credentials to AWS SDKs and tools
+func NewCredentialsEnvMap(creds aws.Credentials) *EnvMap {
+	return NewEnvMap(map[string]string{
+		AWSAccessKeyIDEnvVar:      creds.AccessKeyID,
+		AWSSecreteAccessKeyEnvVar: creds.SecretAccessKey,
+		AWSSecurityTokenEnvVar:    creds.SessionToken,
+		AWSSessionTokenEnvVar:     creds.SessionToken,
+	})
+}
+
 var _ IEnvMap = (*EnvMap)(nil)
 
 // GetShell tries to return a shell to use, starting with a configured one and
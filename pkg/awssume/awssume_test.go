@@ -1,10 +1,18 @@
 package awssume
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
@@ -218,7 +226,7 @@ func TestARNMarshalJSON(t *testing.T) {
 				AccountID: "000000000000",
 				Resource:  "role/skunk",
 			}},
-			jsonBytes:   []byte("arn:aws:iam::000000000000:role/skunk"),
+			jsonBytes:   []byte(`"arn:aws:iam::000000000000:role/skunk"`),
 			errExpected: false,
 		},
 		{
@@ -229,7 +237,7 @@ func TestARNMarshalJSON(t *testing.T) {
 				AccountID: "",
 				Resource:  "",
 			}},
-			jsonBytes:   []byte("arn:::::"),
+			jsonBytes:   []byte(`"arn:::::"`),
 			errExpected: false,
 		},
 	}
@@ -254,7 +262,7 @@ func TestARNUnmarshalJSON(t *testing.T) {
 		errStr      string
 	}{
 		{
-			arnJSON: []byte(`{"arn":"arn:aws:iam::587928718845:role/skunk"}`),
+			arnJSON: []byte(`"arn:aws:iam::587928718845:role/skunk"`),
 			arnStruct: &ARN{&arn.ARN{
 				Partition: "aws",
 				Service:   "iam",
@@ -266,7 +274,7 @@ func TestARNUnmarshalJSON(t *testing.T) {
 			errStr:      "",
 		},
 		{
-			arnJSON: []byte(`"arn:::::"`),
+			arnJSON: []byte(`"skunk"`),
 			arnStruct: &ARN{&arn.ARN{
 				Partition: "",
 				Service:   "",
@@ -277,6 +285,12 @@ func TestARNUnmarshalJSON(t *testing.T) {
 			errExpected: true,
 			errStr:      "arn: invalid prefix",
 		},
+		{
+			arnJSON:     []byte(`{"arn":"arn:aws:iam::587928718845:role/skunk"}`),
+			arnStruct:   &ARN{},
+			errExpected: true,
+			errStr:      "json: cannot unmarshal object into Go value of type string",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -415,3 +429,676 @@ func TestRoleSetSessionName(t *testing.T) {
 		assert.Equal(t, tc.role.SessionName, tc.sessionName)
 	}
 }
+
+func TestRoleGetExternalID(t *testing.T) {
+	testCases := []struct {
+		role       *Role
+		externalID string
+	}{
+		{
+			role:       &Role{ExternalID: "skunk"},
+			externalID: "skunk",
+		},
+		{
+			role:       &Role{},
+			externalID: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.role.GetExternalID(), tc.externalID)
+	}
+}
+
+func TestRoleSetExternalID(t *testing.T) {
+	testCases := []struct {
+		role       *Role
+		externalID string
+	}{
+		{
+			role:       &Role{},
+			externalID: "skunk",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc.role.SetExternalID(tc.externalID)
+		assert.Equal(t, tc.role.ExternalID, tc.externalID)
+	}
+}
+
+func TestRoleGetMFASerial(t *testing.T) {
+	testCases := []struct {
+		role      *Role
+		mfaSerial string
+	}{
+		{
+			role:      &Role{MFASerial: "arn:aws:iam::000000000000:mfa/skunk"},
+			mfaSerial: "arn:aws:iam::000000000000:mfa/skunk",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.role.GetMFASerial(), tc.mfaSerial)
+	}
+}
+
+func TestRoleSetMFASerial(t *testing.T) {
+	testCases := []struct {
+		role      *Role
+		mfaSerial string
+	}{
+		{
+			role:      &Role{},
+			mfaSerial: "arn:aws:iam::000000000000:mfa/skunk",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc.role.SetMFASerial(tc.mfaSerial)
+		assert.Equal(t, tc.role.MFASerial, tc.mfaSerial)
+	}
+}
+
+func TestRoleGetSourceRole(t *testing.T) {
+	testCases := []struct {
+		role       *Role
+		sourceRole string
+	}{
+		{
+			role:       &Role{SourceRole: "skunk"},
+			sourceRole: "skunk",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.role.GetSourceRole(), tc.sourceRole)
+	}
+}
+
+func TestRoleSetSourceRole(t *testing.T) {
+	testCases := []struct {
+		role       *Role
+		sourceRole string
+	}{
+		{
+			role:       &Role{},
+			sourceRole: "skunk",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc.role.SetSourceRole(tc.sourceRole)
+		assert.Equal(t, tc.role.SourceRole, tc.sourceRole)
+	}
+}
+
+func TestConfigGetRoleChain(t *testing.T) {
+	cfg := &Config{Roles: []*Role{
+		{Alias: "bastion"},
+		{Alias: "workload", SourceRole: "bastion"},
+		{Alias: "nested", SourceRole: "workload"},
+		{Alias: "orphan", SourceRole: "missing"},
+		{Alias: "ping", SourceRole: "pong"},
+		{Alias: "pong", SourceRole: "ping"},
+	}}
+
+	testCases := []struct {
+		alias       string
+		chain       []string
+		errExpected bool
+		errStr      string
+	}{
+		{
+			alias: "bastion",
+			chain: []string{"bastion"},
+		},
+		{
+			alias: "nested",
+			chain: []string{"bastion", "workload", "nested"},
+		},
+		{
+			alias:       "orphan",
+			errExpected: true,
+			errStr:      "error getting Role for alias missing: no role with alias missing found",
+		},
+		{
+			alias:       "ping",
+			errExpected: true,
+			errStr:      "cycle detected in role chain: ping -> pong -> ping",
+		},
+	}
+
+	for _, tc := range testCases {
+		chain, err := cfg.GetRoleChain(tc.alias)
+		if tc.errExpected {
+			assert.EqualError(t, err, tc.errStr)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, tc.chain, strings.Split(roleChainString(chain), " -> "))
+	}
+}
+
+// fakeAssumer implements IAssumer by returning credentials named after the
+// requested session, recording the input and source credentials of each call
+type fakeAssumer struct {
+	inputs  []*sts.AssumeRoleInput
+	sources []aws.Credentials
+	err     error
+}
+
+func (f *fakeAssumer) AssumeRole(
+	ctx context.Context,
+	params *sts.AssumeRoleInput,
+	optFns ...func(*sts.Options),
+) (*sts.AssumeRoleOutput, error) {
+	opts := sts.Options{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	var source aws.Credentials
+	if opts.Credentials != nil {
+		source, _ = opts.Credentials.Retrieve(ctx)
+	}
+
+	f.inputs = append(f.inputs, params)
+	f.sources = append(f.sources, source)
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	sessionName := aws.ToString(params.RoleSessionName)
+	return &sts.AssumeRoleOutput{Credentials: &types.Credentials{
+		AccessKeyId:     aws.String("AKIA" + sessionName),
+		SecretAccessKey: aws.String("secret" + sessionName),
+		SessionToken:    aws.String("token" + sessionName),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+// newTestConfig creates a Config on an in-memory filesystem holding the
+// passed Roles
+func newTestConfig(t *testing.T, opts *NewConfigOpts, roles ...*Role) *Config {
+	opts.Fs = afero.NewMemMapFs()
+	opts.Path = "/awssume"
+
+	cfg, err := NewConfig(opts)
+	assert.NoError(t, err)
+
+	for _, r := range roles {
+		if r.ARN == nil {
+			roleARN, err := ParseARN("arn:aws:iam::000000000000:role/" + r.Alias)
+			assert.NoError(t, err)
+			r.ARN = &roleARN
+		}
+
+		assert.NoError(t, cfg.AddRole(r))
+	}
+
+	return cfg
+}
+
+func TestConfigAssumeRole(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer:       assumer,
+		TokenProvider: StaticTokenProvider("123456"),
+	}, &Role{
+		Alias:       "skunk",
+		SessionName: "skunk",
+		ExternalID:  "external",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/skunk",
+	})
+
+	creds, err := cfg.AssumeRole("skunk", 900)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIAskunk", creds.AccessKeyID)
+	assert.Equal(t, "secretskunk", creds.SecretAccessKey)
+	assert.Equal(t, "tokenskunk", creds.SessionToken)
+	assert.Equal(t, CredentialsSource, creds.Source)
+	assert.True(t, creds.CanExpire)
+
+	assert.Len(t, assumer.inputs, 1)
+	input := assumer.inputs[0]
+	assert.Equal(t, "arn:aws:iam::000000000000:role/skunk", aws.ToString(input.RoleArn))
+	assert.Equal(t, "skunk", aws.ToString(input.RoleSessionName))
+	assert.Equal(t, int32(900), aws.ToInt32(input.DurationSeconds))
+	assert.Equal(t, "external", aws.ToString(input.ExternalId))
+	assert.Equal(t, "arn:aws:iam::000000000000:mfa/skunk", aws.ToString(input.SerialNumber))
+	assert.Equal(t, "123456", aws.ToString(input.TokenCode))
+
+	_, err = cfg.AssumeRole("badger", 900)
+	assert.Error(t, err)
+}
+
+func TestConfigAssumeRoleNoTokenProvider(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer}, &Role{
+		Alias:       "skunk",
+		SessionName: "skunk",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/skunk",
+	})
+
+	_, err := cfg.AssumeRole("skunk", 900)
+	assert.ErrorIs(t, err, ErrNoTokenProvider)
+	assert.Empty(t, assumer.inputs)
+}
+
+func TestConfigAssumeRoleChain(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer},
+		&Role{Alias: "bastion", SessionName: "bastion"},
+		&Role{Alias: "workload", SessionName: "workload", SourceRole: "bastion"},
+	)
+
+	creds, err := cfg.AssumeRole("workload", 900)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIAworkload", creds.AccessKeyID)
+
+	assert.Len(t, assumer.inputs, 2)
+	assert.Equal(t, "bastion", aws.ToString(assumer.inputs[0].RoleSessionName))
+	assert.Equal(t, "workload", aws.ToString(assumer.inputs[1].RoleSessionName))
+	assert.Equal(t, aws.Credentials{}, assumer.sources[0])
+	assert.Equal(t, "AKIAbastion", assumer.sources[1].AccessKeyID)
+
+	assumer.err = errors.New("access denied")
+	_, err = cfg.AssumeRole("workload", 900)
+	assert.ErrorContains(t, err, "error assuming Role bastion (hop 1 of 2 in chain bastion -> workload)")
+	assert.ErrorContains(t, err, "access denied")
+}
+
+func TestConfigAssumeRoleCache(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer: assumer,
+		Cache: NewFileCache(&NewFileCacheOpts{
+			Fs: afero.NewMemMapFs(), Dir: "/cache",
+		}),
+	},
+		&Role{Alias: "bastion", SessionName: "bastion"},
+		&Role{Alias: "workload", SessionName: "workload", SourceRole: "bastion"},
+	)
+
+	first, err := cfg.AssumeRole("workload", 900)
+	assert.NoError(t, err)
+	assert.Len(t, assumer.inputs, 2)
+
+	second, err := cfg.AssumeRole("workload", 900)
+	assert.NoError(t, err)
+	assert.Len(t, assumer.inputs, 2)
+	assert.Equal(t, first.AccessKeyID, second.AccessKeyID)
+
+	// The intermediate Role is cached too, so only the last hop is repeated
+	// once the target Role's credentials are gone
+	workload, err := cfg.GetRoleByAlias("workload")
+	assert.NoError(t, err)
+
+	fc := cfg.cache.(*FileCache)
+	assert.NoError(t, fc.fs.Remove(fc.entryPath(CacheKey(workload, 900))))
+
+	_, err = cfg.AssumeRole("workload", 900)
+	assert.NoError(t, err)
+	assert.Len(t, assumer.inputs, 3)
+	assert.Equal(t, "workload", aws.ToString(assumer.inputs[2].RoleSessionName))
+
+	// Credentials cached for a shorter session are not reused for a longer one
+	_, err = cfg.AssumeRole("workload", 1800)
+	assert.NoError(t, err)
+	assert.Len(t, assumer.inputs, 4)
+	assert.Equal(t, "workload", aws.ToString(assumer.inputs[3].RoleSessionName))
+	assert.Equal(t, int32(1800), aws.ToInt32(assumer.inputs[3].DurationSeconds))
+}
+
+func TestConfigExecRole(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: &fakeAssumer{}}, &Role{
+		Alias: "skunk", SessionName: "skunk",
+	})
+
+	assert.NoError(t, cfg.ExecRole("skunk", 900, "sh", []string{
+		"-c", `[ "$AWS_ACCESS_KEY_ID" = AKIAskunk ] && ` +
+			`[ "$AWS_SECRET_ACCESS_KEY" = secretskunk ] && ` +
+			`[ "$AWS_SESSION_TOKEN" = tokenskunk ] && ` +
+			`[ "$AWS_SECURITY_TOKEN" = tokenskunk ]`,
+	}))
+
+	var exitErr *ExitError
+	assert.ErrorAs(t, cfg.ExecRole("skunk", 900, "sh", []string{"-c", "exit 3"}), &exitErr)
+	assert.Equal(t, 3, exitErr.Code)
+
+	assert.Error(t, cfg.ExecRole("badger", 900, "true", []string{}))
+}
+
+func TestConfigRenameRoleByAlias(t *testing.T) {
+	cfg := &Config{Roles: []*Role{
+		{Alias: "bastion"},
+		{Alias: "workload", SourceRole: "bastion"},
+	}}
+
+	assert.NoError(t, cfg.RenameRoleByAlias("bastion", "hub"))
+	assert.Equal(t, "hub", cfg.Roles[0].GetAlias())
+	assert.Equal(t, "hub", cfg.Roles[1].GetSourceRole())
+
+	assert.ErrorIs(t, cfg.RenameRoleByAlias("hub", "workload"), ErrAliasTaken)
+	assert.EqualError(t, cfg.RenameRoleByAlias("bastion", "skunk"), "no role with alias bastion found")
+}
+
+func TestConfigAssumeRoleTags(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer}, &Role{
+		Alias:             "skunk",
+		SessionName:       "skunk",
+		Tags:              map[string]string{"team": "platform", "ticket": "OPS-1"},
+		TransitiveTagKeys: []string{"team"},
+	}, &Role{
+		Alias:             "badger",
+		SessionName:       "badger",
+		Tags:              map[string]string{"team": "platform"},
+		TransitiveTagKeys: []string{"ticket"},
+	})
+
+	_, err := cfg.AssumeRole("skunk", 900)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Tag{
+		{Key: aws.String("team"), Value: aws.String("platform")},
+		{Key: aws.String("ticket"), Value: aws.String("OPS-1")},
+	}, assumer.inputs[0].Tags)
+	assert.Equal(t, []string{"team"}, assumer.inputs[0].TransitiveTagKeys)
+
+	_, err = cfg.AssumeRole("badger", 900)
+	assert.EqualError(t, err, "transitive tag key ticket is not a session tag")
+	assert.Len(t, assumer.inputs, 1)
+}
+
+func TestConfigAssumeRolePolicies(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer}, &Role{
+		Alias:       "skunk",
+		SessionName: "skunk",
+		Policy:      "{\n  \"Version\": \"2012-10-17\"\n}",
+		PolicyARNs:  []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}, &Role{
+		Alias:       "badger",
+		SessionName: "badger",
+		Policy:      "Version: 2012-10-17",
+	})
+
+	_, err := cfg.AssumeRole("skunk", 900)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Version":"2012-10-17"}`, aws.ToString(assumer.inputs[0].Policy))
+	assert.Equal(t, []types.PolicyDescriptorType{
+		{Arn: aws.String("arn:aws:iam::aws:policy/ReadOnlyAccess")},
+	}, assumer.inputs[0].PolicyArns)
+
+	_, err = cfg.AssumeRole("badger", 900)
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	assert.Len(t, assumer.inputs, 1)
+}
+
+func TestConfigAssumeRoleSourceIdentity(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer:      assumer,
+		TemplateData: &TemplateData{User: "skunk"},
+	}, &Role{
+		Alias:          "skunk",
+		SessionName:    "skunk",
+		SourceIdentity: DefaultSourceIdentity,
+	}, &Role{
+		Alias:          "badger",
+		SessionName:    "badger",
+		SourceIdentity: "{{.User}} badger",
+	})
+
+	_, err := cfg.AssumeRole("skunk", 900)
+	assert.NoError(t, err)
+	assert.Equal(t, "skunk", aws.ToString(assumer.inputs[0].SourceIdentity))
+
+	_, err = cfg.AssumeRole("badger", 900)
+	assert.ErrorIs(t, err, ErrInvalidSourceIdentity)
+	assert.Len(t, assumer.inputs, 1)
+}
+
+func TestConfigAssumeRoleSessionNameTemplate(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer: assumer,
+		TemplateData: &TemplateData{
+			User:      "skunk",
+			Host:      "burrow local",
+			Timestamp: "20200102T030405Z",
+		},
+	}, &Role{
+		Alias:       "skunk",
+		SessionName: "{{.User}}-{{.Host}}-{{.Timestamp}}",
+	})
+
+	assert.NoError(t, cfg.ExecRole("skunk", 900, "true", nil))
+	assert.Equal(
+		t,
+		"skunk-burrow-local-20200102T030405Z",
+		aws.ToString(assumer.inputs[0].RoleSessionName),
+	)
+}
+
+func TestConfigAssumeRoleShortSessionName(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer:      assumer,
+		TemplateData: &TemplateData{User: ""},
+	}, &Role{Alias: "skunk", SessionName: "{{.User}}"})
+
+	_, err := cfg.AssumeRole("skunk", 900)
+	assert.ErrorIs(t, err, ErrInvalidSessionName)
+	assert.Empty(t, assumer.inputs)
+}
+
+func TestConfigAssumeRoleSessionDuration(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		roleDuration    int32
+		sessionDuration int32
+		expected        int32
+		err             error
+	}{
+		{name: "default", expected: DefaultSessionDuration},
+		{name: "role default", roleDuration: 7200, expected: 7200},
+		{name: "explicit", roleDuration: 7200, sessionDuration: 900, expected: 900},
+		{name: "too short", sessionDuration: 899, err: ErrInvalidSessionDuration},
+		{name: "too long", roleDuration: 43201, err: ErrInvalidSessionDuration},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assumer := &fakeAssumer{}
+			cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer}, &Role{
+				Alias:           "skunk",
+				SessionName:     "skunk",
+				SessionDuration: tc.roleDuration,
+			})
+
+			_, err := cfg.AssumeRole("skunk", tc.sessionDuration)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.Empty(t, assumer.inputs)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, aws.ToInt32(assumer.inputs[0].DurationSeconds))
+		})
+	}
+}
+
+func TestConfigAssumeRoleChainSessionDuration(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		bastionDuration int32
+		roleDuration    int32
+		sessionDuration int32
+		expected        []int32
+		err             error
+	}{
+		{name: "default", expected: []int32{DefaultSessionDuration, DefaultSessionDuration}},
+		{name: "explicit", sessionDuration: 900, expected: []int32{DefaultSessionDuration, 900}},
+		{name: "source", bastionDuration: 7200, expected: []int32{7200, DefaultSessionDuration}},
+		{name: "explicit too long", sessionDuration: 7200, err: ErrChainedSessionDuration},
+		{name: "role too long", roleDuration: 7200, err: ErrChainedSessionDuration},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assumer := &fakeAssumer{}
+			cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer}, &Role{
+				Alias:           "bastion",
+				SessionName:     "bastion",
+				SessionDuration: tc.bastionDuration,
+			}, &Role{
+				Alias:           "workload",
+				SessionName:     "workload",
+				SourceRole:      "bastion",
+				SessionDuration: tc.roleDuration,
+			})
+
+			_, err := cfg.AssumeRole("workload", tc.sessionDuration)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.Empty(t, assumer.inputs)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, assumer.inputs, len(tc.expected))
+			for i, expected := range tc.expected {
+				assert.Equal(t, expected, aws.ToInt32(assumer.inputs[i].DurationSeconds))
+			}
+		})
+	}
+
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: assumer},
+		&Role{Alias: "bastion", SessionName: "bastion"},
+		&Role{Alias: "jump", SessionName: "jump", SourceRole: "bastion", SessionDuration: 7200},
+		&Role{Alias: "workload", SessionName: "workload", SourceRole: "jump"},
+	)
+
+	_, err := cfg.AssumeRole("workload", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxChainedSessionDuration, aws.ToInt32(assumer.inputs[1].DurationSeconds))
+}
+
+func TestConfigExecRoleEnv(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: &fakeAssumer{}}, &Role{
+		Alias:       "skunk",
+		SessionName: "skunk",
+		Region:      "eu-west-1",
+		Env: map[string]string{
+			"SKUNK":             "stripes",
+			"AWS_ACCESS_KEY_ID": "ignored",
+		},
+	})
+
+	assert.NoError(t, cfg.ExecRole("skunk", 0, "sh", []string{
+		"-c", `[ "$AWS_REGION" = eu-west-1 ] && ` +
+			`[ "$SKUNK" = stripes ] && ` +
+			`[ "$AWS_ACCESS_KEY_ID" = AKIAskunk ]`,
+	}))
+}
+
+func TestConfigAddRoleExists(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{}, &Role{Alias: "skunk", SessionName: "skunk"})
+
+	err := cfg.AddRole(&Role{Alias: "skunk", SessionName: "badger"})
+	assert.ErrorIs(t, err, ErrAliasTaken)
+	assert.EqualError(t, err, "role skunk already exists: alias is already in use")
+}
+
+func TestConfigSaveRoundTrip(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{}, &Role{
+		Alias:             "skunk",
+		SessionName:       "skunk",
+		ExternalID:        "external",
+		MFASerial:         "arn:aws:iam::000000000000:mfa/skunk",
+		SourceRole:        "badger",
+		Tags:              map[string]string{"team": "platform"},
+		TransitiveTagKeys: []string{"team"},
+		Policy:            `{"Version":"2012-10-17"}`,
+		PolicyARNs:        []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		SourceIdentity:    DefaultSourceIdentity,
+	})
+	assert.NoError(t, cfg.Save())
+
+	loaded, err := NewConfig(&NewConfigOpts{Fs: cfg.fs, Path: cfg.GetPath()})
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.Roles, loaded.Roles)
+}
+
+func TestConfigFormatRoundTrip(t *testing.T) {
+	testCases := []struct {
+		format ConfigFormat
+		data   string
+	}{
+		{
+			format: JSON,
+			data: `{"version":2,"roles":[{"alias":"skunk",` +
+				`"arn":"arn:aws:iam::000000000000:role/skunk",` +
+				`"session_name":"skunk","external_id":"external"}]}`,
+		},
+		{
+			format: TOML,
+			data: "version = 2\n\n[[roles]]\nalias = \"skunk\"\n" +
+				"arn = \"arn:aws:iam::000000000000:role/skunk\"\n" +
+				"session_name = \"skunk\"\nexternal_id = \"external\"\n",
+		},
+		{
+			format: YAML,
+			data: "version: 2\nroles:\n- alias: skunk\n" +
+				"  arn: arn:aws:iam::000000000000:role/skunk\n" +
+				"  session_name: skunk\n  external_id: external\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			cfgPath := "/awssume." + tc.format.String()
+			assert.NoError(t, afero.WriteFile(fs, cfgPath, []byte(tc.data), 0o600))
+
+			cfg, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.format, cfg.GetFormat())
+
+			r, err := cfg.GetRoleByAlias("skunk")
+			assert.NoError(t, err)
+			assert.Equal(t, "arn:aws:iam::000000000000:role/skunk", r.GetARN().String())
+			assert.Equal(t, "external", r.GetExternalID())
+
+			r.SetExternalID("rotated")
+			assert.NoError(t, cfg.Save())
+
+			saved, err := afero.ReadFile(fs, cfgPath)
+			assert.NoError(t, err)
+			assert.Contains(t, string(saved), "rotated")
+
+			loaded, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+			assert.NoError(t, err)
+			assert.Equal(t, cfg.Roles, loaded.Roles)
+		})
+	}
+}
+
+func TestConfigSaveModified(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{}, &Role{Alias: "skunk", SessionName: "skunk"})
+	assert.NoError(t, cfg.Save())
+	assert.NoError(t, cfg.Save())
+
+	other, err := NewConfig(&NewConfigOpts{Fs: cfg.fs, Path: cfg.GetPath()})
+	assert.NoError(t, err)
+	assert.NoError(t, other.AddRole(&Role{Alias: "badger", SessionName: "badger"}))
+	assert.NoError(t, other.Save())
+
+	assert.ErrorIs(t, cfg.Save(), ErrConfigModified)
+
+	loaded, err := NewConfig(&NewConfigOpts{Fs: cfg.fs, Path: cfg.GetPath()})
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Roles, 2)
+}
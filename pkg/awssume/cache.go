@@ -0,0 +1,228 @@
+package awssume
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/afero"
+)
+
+const (
+	// DefaultCacheDirPath is the default filesystem path, relative to the
+	// user's home directory, where assumed Role credentials are cached
+	DefaultCacheDirPath string = ".cache/awssume"
+
+	// DefaultCacheExpiryWindow is how long before their expiration cached
+	// credentials stop being reused
+	DefaultCacheExpiryWindow time.Duration = 5 * time.Minute
+
+	// encryptedCacheExt is the file extension of encrypted cache entries
+	encryptedCacheExt string = "enc"
+)
+
+// ICache describes a store for assumed Role credentials
+type ICache interface {
+	// Get returns the cached credentials for the passed key, or nil if there
+	// are none that are still usable
+	Get(key string) (*aws.Credentials, error)
+
+	// Set caches the passed credentials under the passed key
+	Set(key string, creds aws.Credentials) error
+
+	// Clear removes all cached credentials
+	Clear() error
+}
+
+// cacheKeyParts holds the Role attributes that determine the credentials
+// assuming it yields, either as part of the AssumeRole call or by choosing
+// the credentials it is made with
+type cacheKeyParts struct {
+	Alias             string            `json:"alias"`
+	ARN               string            `json:"arn"`
+	SessionName       string            `json:"session_name"`
+	ExternalID        string            `json:"external_id"`
+	MFASerial         string            `json:"mfa_serial"`
+	SourceRole        string            `json:"source_role"`
+	Tags              map[string]string `json:"tags"`
+	TransitiveTagKeys []string          `json:"transitive_tag_keys"`
+	Policy            string            `json:"policy"`
+	PolicyARNs        []string          `json:"policy_arns"`
+	SourceIdentity    string            `json:"source_identity"`
+	SessionDuration   int32             `json:"session_duration"`
+}
+
+// CacheKey returns the key under which credentials for the passed Role,
+// assumed for the passed session duration, are cached
+func CacheKey(r IRole, sessionDuration int32) string {
+	// Marshaling a struct of numbers, strings, maps and slices of strings
+	// cannot fail
+	bytes, _ := json.Marshal(&cacheKeyParts{
+		Alias:             r.GetAlias(),
+		ARN:               r.GetARN().String(),
+		SessionName:       r.GetSessionName(),
+		ExternalID:        r.GetExternalID(),
+		MFASerial:         r.GetMFASerial(),
+		SourceRole:        r.GetSourceRole(),
+		Tags:              r.GetTags(),
+		TransitiveTagKeys: r.GetTransitiveTagKeys(),
+		Policy:            r.GetPolicy(),
+		PolicyARNs:        r.GetPolicyARNs(),
+		SourceIdentity:    r.GetSourceIdentity(),
+		SessionDuration:   sessionDuration,
+	})
+
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheEntry is the on-disk representation of cached credentials
+type cacheEntry struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// FileCache implements ICache by storing one file per cache key in a
+// directory, optionally encrypted
+type FileCache struct {
+	// fs is an afero.Fs for filesystem operations
+	fs afero.Fs
+
+	// dir is the directory cache files are stored in
+	dir string
+
+	// expiryWindow is how long before their expiration credentials stop
+	// being returned from the cache
+	expiryWindow time.Duration
+
+	// cipher encrypts cache entries at rest. Entries are stored in plaintext
+	// if it is nil.
+	cipher ICipher
+}
+
+// Get returns the cached credentials for the passed key, or nil if there are
+// none or they expire within the expiry window. Encrypted entries that cannot
+// be decrypted, e.g. because the key has changed, and entries that cannot be
+// parsed, e.g. because they were damaged, are treated as absent.
+func (fc *FileCache) Get(key string) (*aws.Credentials, error) {
+	entryPath := fc.entryPath(key)
+
+	bytes, err := afero.ReadFile(fc.fs, entryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf(ErrReadingFile, entryPath, err)
+	}
+
+	if fc.cipher != nil {
+		bytes, err = fc.cipher.Open(bytes, []byte(key))
+		if err != nil {
+			return nil, nil
+		}
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(bytes, &entry); err != nil {
+		return nil, nil
+	}
+
+	if !entry.Expiration.After(time.Now().Add(fc.expiryWindow)) {
+		return nil, nil
+	}
+
+	return &aws.Credentials{
+		AccessKeyID:     entry.AccessKeyID,
+		SecretAccessKey: entry.SecretAccessKey,
+		SessionToken:    entry.SessionToken,
+		Source:          CredentialsSource,
+		CanExpire:       true,
+		Expires:         entry.Expiration,
+	}, nil
+}
+
+// Set caches the passed credentials under the passed key. Credentials that
+// do not expire are not cached. Entries are written atomically, so that
+// concurrent processes never read a partially written one.
+func (fc *FileCache) Set(key string, creds aws.Credentials) error {
+	if !creds.CanExpire {
+		return nil
+	}
+
+	bytes, err := json.Marshal(&cacheEntry{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expires,
+	})
+	if err != nil {
+		return fmt.Errorf(ErrMarshal, err)
+	}
+
+	if fc.cipher != nil {
+		bytes, err = fc.cipher.Seal(bytes, []byte(key))
+		if err != nil {
+			return fmt.Errorf(ErrEncrypt, err)
+		}
+	}
+
+	if err := fc.fs.MkdirAll(fc.dir, os.FileMode(0o700)); err != nil {
+		return fmt.Errorf(ErrCreatingFile, err)
+	}
+
+	return writeFileAtomic(fc.fs, fc.entryPath(key), bytes, os.FileMode(0o600))
+}
+
+// Clear removes all cached credentials
+func (fc *FileCache) Clear() error { return fc.fs.RemoveAll(fc.dir) }
+
+// entryPath returns the path of the cache file for the passed key
+func (fc *FileCache) entryPath(key string) string {
+	ext := JSON.String()
+	if fc.cipher != nil {
+		ext = encryptedCacheExt
+	}
+
+	return path.Join(fc.dir, strings.Join([]string{key, ext}, "."))
+}
+
+var _ ICache = (*FileCache)(nil)
+
+// NewFileCacheOpts is an option set passed to the file cache constructor
+type NewFileCacheOpts struct {
+	Fs  afero.Fs
+	Dir string
+
+	// ExpiryWindow is how long before their expiration credentials stop being
+	// reused. DefaultCacheExpiryWindow is used if it is zero.
+	ExpiryWindow time.Duration
+
+	// Cipher encrypts cache entries at rest. Entries are stored in plaintext
+	// if it is nil.
+	Cipher ICipher
+}
+
+// NewFileCache creates a new FileCache
+func NewFileCache(opts *NewFileCacheOpts) *FileCache {
+	expiryWindow := opts.ExpiryWindow
+	if expiryWindow == 0 {
+		expiryWindow = DefaultCacheExpiryWindow
+	}
+
+	return &FileCache{
+		fs:           opts.Fs,
+		dir:          opts.Dir,
+		expiryWindow: expiryWindow,
+		cipher:       opts.Cipher,
+	}
+}
@@ -0,0 +1,190 @@
+package awssume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheKey(t *testing.T) {
+	role := &Role{
+		Alias: "skunk",
+		ARN: &ARN{&arn.ARN{
+			Partition: "aws",
+			Service:   "iam",
+			AccountID: "000000000000",
+			Resource:  "role/skunk",
+		}},
+		SessionName: "skunk",
+	}
+
+	assert.Equal(t, CacheKey(role, 900), CacheKey(role, 900))
+	assert.NotEqual(t, CacheKey(role, 900), CacheKey(role, 3600))
+
+	testCases := []struct {
+		field  string
+		change func(r *Role)
+	}{
+		{field: "alias", change: func(r *Role) { r.Alias = "badger" }},
+		{field: "arn", change: func(r *Role) {
+			r.ARN = &ARN{&arn.ARN{
+				Partition: "aws",
+				Service:   "iam",
+				AccountID: "000000000000",
+				Resource:  "role/badger",
+			}}
+		}},
+		{field: "session_name", change: func(r *Role) { r.SessionName = "badger" }},
+		{field: "external_id", change: func(r *Role) { r.ExternalID = "external" }},
+		{field: "mfa_serial", change: func(r *Role) {
+			r.MFASerial = "arn:aws:iam::000000000000:mfa/skunk"
+		}},
+		{field: "source_role", change: func(r *Role) { r.SourceRole = "badger" }},
+		{field: "tags", change: func(r *Role) { r.Tags = map[string]string{"team": "skunks"} }},
+		{field: "transitive_tag_keys", change: func(r *Role) {
+			r.TransitiveTagKeys = []string{"team"}
+		}},
+		{field: "policy", change: func(r *Role) { r.Policy = `{"Version":"2012-10-17"}` }},
+		{field: "policy_arns", change: func(r *Role) {
+			r.PolicyARNs = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}
+		}},
+		{field: "source_identity", change: func(r *Role) { r.SourceIdentity = "skunk" }},
+	}
+
+	for _, tc := range testCases {
+		other := *role
+		tc.change(&other)
+		assert.NotEqual(t, CacheKey(role, 900), CacheKey(&other, 900), tc.field)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	testCases := []struct {
+		creds    aws.Credentials
+		expected bool
+	}{
+		{
+			creds: aws.Credentials{
+				AccessKeyID:     "AKIA",
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				CanExpire:       true,
+				Expires:         time.Now().Add(time.Hour).Round(0),
+			},
+			expected: true,
+		},
+		{
+			creds: aws.Credentials{
+				AccessKeyID:     "AKIA",
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				CanExpire:       true,
+				Expires:         time.Now().Add(time.Minute).Round(0),
+			},
+			expected: false,
+		},
+		{
+			creds: aws.Credentials{
+				AccessKeyID:     "AKIA",
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				CanExpire:       false,
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		fc := NewFileCache(&NewFileCacheOpts{
+			Fs: afero.NewMemMapFs(), Dir: "/cache",
+		})
+
+		cached, err := fc.Get("skunk")
+		assert.NoError(t, err)
+		assert.Nil(t, cached)
+
+		assert.NoError(t, fc.Set("skunk", tc.creds))
+
+		cached, err = fc.Get("skunk")
+		assert.NoError(t, err)
+		if !tc.expected {
+			assert.Nil(t, cached)
+			continue
+		}
+
+		assert.Equal(t, tc.creds.AccessKeyID, cached.AccessKeyID)
+		assert.Equal(t, tc.creds.SecretAccessKey, cached.SecretAccessKey)
+		assert.Equal(t, tc.creds.SessionToken, cached.SessionToken)
+		assert.True(t, tc.creds.Expires.Equal(cached.Expires))
+
+		assert.NoError(t, fc.Clear())
+
+		cached, err = fc.Get("skunk")
+		assert.NoError(t, err)
+		assert.Nil(t, cached)
+	}
+}
+
+func TestFileCacheDamaged(t *testing.T) {
+	fc := NewFileCache(&NewFileCacheOpts{Fs: afero.NewMemMapFs(), Dir: "/cache"})
+	assert.NoError(t, afero.WriteFile(fc.fs, fc.entryPath("skunk"), []byte(`{"access_key_id":`), 0o600))
+
+	cached, err := fc.Get("skunk")
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	assert.NoError(t, fc.Set("skunk", aws.Credentials{
+		AccessKeyID: "AKIA",
+		CanExpire:   true,
+		Expires:     time.Now().Add(time.Hour),
+	}))
+
+	cached, err = fc.Get("skunk")
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", cached.AccessKeyID)
+
+	entries, err := afero.ReadDir(fc.fs, "/cache")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileCacheEncrypted(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, EnsureKeyFile(fs, "/awssume.key"))
+
+	c, err := NewKeyFileCipher(fs, "/awssume.key")
+	assert.NoError(t, err)
+
+	fc := NewFileCache(&NewFileCacheOpts{Fs: fs, Dir: "/cache", Cipher: c})
+	creds := aws.Credentials{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Now().Add(time.Hour).Round(0),
+	}
+
+	assert.NoError(t, fc.Set("skunk", creds))
+
+	raw, err := afero.ReadFile(fs, "/cache/skunk.enc")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "secret")
+	assert.NotContains(t, string(raw), "token")
+
+	cached, err := fc.Get("skunk")
+	assert.NoError(t, err)
+	assert.Equal(t, creds.SecretAccessKey, cached.SecretAccessKey)
+
+	other, err := NewPassphraseCipher("badger")
+	assert.NoError(t, err)
+
+	cached, err = NewFileCache(&NewFileCacheOpts{
+		Fs: fs, Dir: "/cache", Cipher: other,
+	}).Get("skunk")
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+}
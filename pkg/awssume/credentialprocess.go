@@ -0,0 +1,40 @@
+package awssume
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// CredentialProcessVersion is the version of the credential_process output
+// format
+const CredentialProcessVersion int = 1
+
+// CredentialProcessOutput is the document a credential_process command writes
+// to stdout for AWS SDKs and tools to read credentials from, see
+// https://docs.aws.amazon.com/sdkref/latest/guide/feature-process-credentials.html
+type CredentialProcessOutput struct {
+	Version         int        `json:"Version"`
+	AccessKeyID     string     `json:"AccessKeyId"`
+	SecretAccessKey string     `json:"SecretAccessKey"`
+	SessionToken    string     `json:"SessionToken,omitempty"`
+	Expiration      *time.Time `json:"Expiration,omitempty"`
+}
+
+// NewCredentialProcessOutput creates the credential_process document holding
+// the passed credentials
+func NewCredentialProcessOutput(creds aws.Credentials) *CredentialProcessOutput {
+	out := &CredentialProcessOutput{
+		Version:         CredentialProcessVersion,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+	}
+
+	if creds.CanExpire {
+		expiration := creds.Expires.UTC()
+		out.Expiration = &expiration
+	}
+
+	return out
+}
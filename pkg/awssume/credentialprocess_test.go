@@ -0,0 +1,41 @@
+package awssume
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCredentialProcessOutput(t *testing.T) {
+	expires := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+
+	out, err := json.Marshal(NewCredentialProcessOutput(aws.Credentials{
+		AccessKeyID:     "AKIAskunk",
+		SecretAccessKey: "secretskunk",
+		SessionToken:    "tokenskunk",
+		CanExpire:       true,
+		Expires:         expires,
+	}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Version": 1,
+		"AccessKeyId": "AKIAskunk",
+		"SecretAccessKey": "secretskunk",
+		"SessionToken": "tokenskunk",
+		"Expiration": "2020-01-02T08:04:05Z"
+	}`, string(out))
+
+	out, err = json.Marshal(NewCredentialProcessOutput(aws.Credentials{
+		AccessKeyID:     "AKIAskunk",
+		SecretAccessKey: "secretskunk",
+	}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Version": 1,
+		"AccessKeyId": "AKIAskunk",
+		"SecretAccessKey": "secretskunk"
+	}`, string(out))
+}
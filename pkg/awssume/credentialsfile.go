@@ -0,0 +1,328 @@
+package awssume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrUnmanagedProfile is returned when a shared AWS credentials file profile
+// that awssume did not write would be overwritten
+var ErrUnmanagedProfile error = errors.New("profile was not written by awssume")
+
+const (
+	// DefaultAWSCredentialsFilePath is the default filesystem path, relative
+	// to the user's home directory, of the shared AWS credentials file
+	DefaultAWSCredentialsFilePath string = ".aws/credentials"
+
+	// AWSSharedCredentialsFileEnvVar is the environment variable that, when
+	// set, holds the path of the shared AWS credentials file
+	AWSSharedCredentialsFileEnvVar string = "AWS_SHARED_CREDENTIALS_FILE"
+
+	// DefaultCredentialsFileRetryInterval is how long to wait before trying
+	// again when credentials cannot be refreshed
+	DefaultCredentialsFileRetryInterval time.Duration = time.Minute
+
+	// credentialsExpirationKey is the shared AWS credentials file key that
+	// holds the expiration of credentials written by awssume, and marks the
+	// profiles it manages
+	credentialsExpirationKey string = "awssume_expiration"
+
+	// credentialsNeverExpire is the expiration written for credentials that
+	// do not expire
+	credentialsNeverExpire string = "never"
+)
+
+// MergeCredentialsFile sets the credentials of the passed profile in the
+// passed shared AWS credentials file contents, leaving other profiles and
+// comments untouched. The profile is marked as managed by awssume.
+func MergeCredentialsFile(data []byte, profile string, creds aws.Credentials) []byte {
+	f := parseINI(data)
+
+	s := f.section(profile)
+	if s == nil {
+		s = f.addSection(profile)
+	}
+
+	s.set("aws_access_key_id", creds.AccessKeyID)
+	s.set("aws_secret_access_key", creds.SecretAccessKey)
+	if creds.SessionToken != "" {
+		s.set("aws_session_token", creds.SessionToken)
+	} else {
+		s.unset("aws_session_token")
+	}
+
+	expiration := credentialsNeverExpire
+	if creds.CanExpire {
+		expiration = creds.Expires.UTC().Format(time.RFC3339)
+	}
+	s.set(credentialsExpirationKey, expiration)
+
+	return f.bytes()
+}
+
+// CheckCredentialsProfile returns an error wrapping ErrUnmanagedProfile if
+// the passed shared AWS credentials file contents define the passed profile,
+// but not as a profile managed by awssume
+func CheckCredentialsProfile(data []byte, profile string) error {
+	s := parseINI(data).section(profile)
+	if s == nil {
+		return nil
+	}
+
+	if _, ok := s.get(credentialsExpirationKey); !ok {
+		return fmt.Errorf(ErrWriteProfile, profile, ErrUnmanagedProfile)
+	}
+
+	return nil
+}
+
+// WriteCredentialsProfile sets the credentials of the passed profile in the
+// shared AWS credentials file at path, as MergeCredentialsFile does. Unless
+// force is set, a profile that awssume did not write is not overwritten.
+func WriteCredentialsProfile(path, profile string, creds aws.Credentials, force bool) error {
+	return editFileAtomic(path, 0o600, func(data []byte) ([]byte, error) {
+		if !force {
+			if err := CheckCredentialsProfile(data, profile); err != nil {
+				return nil, err
+			}
+		}
+
+		return MergeCredentialsFile(data, profile, creds), nil
+	})
+}
+
+// CleanupCredentialsProfiles removes the profiles managed by awssume whose
+// credentials expired by now from the shared AWS credentials file at path, as
+// CleanupCredentialsFile does, returning the removed profiles
+func CleanupCredentialsProfiles(path string, now time.Time) ([]string, error) {
+	var removed []string
+	err := editFileAtomic(path, 0o600, func(data []byte) ([]byte, error) {
+		var cleaned []byte
+		cleaned, removed = CleanupCredentialsFile(data, now)
+		return cleaned, nil
+	})
+
+	return removed, err
+}
+
+// CleanupCredentialsFile removes the profiles managed by awssume whose
+// credentials expired by now from the passed shared AWS credentials file
+// contents, returning the resulting contents and the removed profiles
+func CleanupCredentialsFile(data []byte, now time.Time) ([]byte, []string) {
+	f := parseINI(data)
+	removed := []string{}
+
+	for _, s := range f.sections[1:] {
+		value, ok := s.get(credentialsExpirationKey)
+		if !ok {
+			continue
+		}
+
+		// Credentials that never expire are never stale
+		expiration, err := time.Parse(time.RFC3339, value)
+		if err != nil || expiration.After(now) {
+			continue
+		}
+
+		removed = append(removed, s.name)
+	}
+
+	for _, profile := range removed {
+		f.removeSection(profile)
+	}
+
+	return f.bytes(), removed
+}
+
+// CredentialsFile keeps a shared AWS credentials file holding the
+// credentials of a provider, rewriting it shortly before they expire. It
+// suits tools that read the credentials file anew every time they start,
+// e.g. scripts invoking the AWS CLI, but that do not support container
+// credentials endpoints.
+type CredentialsFile struct {
+	// provider supplies the written credentials
+	provider aws.CredentialsProvider
+
+	// path is the filesystem path of the credentials file
+	path string
+
+	// profile is the profile the credentials are written to
+	profile string
+
+	// retryInterval is how long to wait before trying again when
+	// credentials cannot be refreshed
+	retryInterval time.Duration
+}
+
+// GetPath returns the filesystem path of the credentials file
+func (f *CredentialsFile) GetPath() string { return f.path }
+
+// Env returns the environment variables that point AWS SDKs and tools at the
+// credentials file
+func (f *CredentialsFile) Env() *EnvMap {
+	return NewEnvMap(map[string]string{
+		AWSSharedCredentialsFileEnvVar: f.path,
+		AWSProfileEnvVar:               f.profile,
+	})
+}
+
+// Write retrieves credentials, refreshing them first if they are about to
+// expire, and writes them to the credentials file
+func (f *CredentialsFile) Write(ctx context.Context) (aws.Credentials, error) {
+	creds, err := f.provider.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	return creds, WriteCredentialsProfile(f.path, f.profile, creds, true)
+}
+
+// Refresh writes the credentials file, and rewrites it whenever the
+// credentials are about to expire until ctx is done. Failed refreshes are
+// retried, since the credentials written before remain valid for a while.
+func (f *CredentialsFile) Refresh(ctx context.Context) {
+	for {
+		wait := f.retryInterval
+
+		creds, err := f.Write(ctx)
+		if err == nil {
+			if !creds.CanExpire {
+				return
+			}
+
+			wait = time.Until(creds.Expires)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// NewCredentialsFileOpts is an option set passed to the credentials file
+// constructor
+type NewCredentialsFileOpts struct {
+	// Provider supplies the written credentials, e.g. a
+	// RoleCredentialsProvider
+	Provider aws.CredentialsProvider
+
+	// Path is the filesystem path of the credentials file
+	Path string
+
+	// Profile is the profile the credentials are written to
+	Profile string
+
+	// ExpiryWindow is how long before they expire credentials are refreshed.
+	// DefaultServerExpiryWindow is used if it is zero.
+	ExpiryWindow time.Duration
+
+	// RetryInterval is how long to wait before trying again when credentials
+	// cannot be refreshed. DefaultCredentialsFileRetryInterval is used if it
+	// is zero.
+	RetryInterval time.Duration
+}
+
+// NewCredentialsFile creates a new CredentialsFile
+func NewCredentialsFile(opts *NewCredentialsFileOpts) *CredentialsFile {
+	expiryWindow := opts.ExpiryWindow
+	if expiryWindow == 0 {
+		expiryWindow = DefaultServerExpiryWindow
+	}
+
+	retryInterval := opts.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = DefaultCredentialsFileRetryInterval
+	}
+
+	return &CredentialsFile{
+		provider: aws.NewCredentialsCache(opts.Provider, func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = expiryWindow
+		}),
+		path:          opts.Path,
+		profile:       opts.Profile,
+		retryInterval: retryInterval,
+	}
+}
+
+// RefreshExecRole is like ExecRole, but instead of static credentials the
+// subprocess is given a private shared credentials file, which is rewritten
+// with fresh credentials before they expire for as long as the subprocess
+// runs. Static credentials and other credential sources inherited from the
+// environment are removed, as AWS SDKs and tools prefer them over the
+// credentials file, and the subprocess is pointed at an empty shared AWS
+// config file, so that the settings of the user's default profile, e.g. a
+// role_arn, do not take precedence over the credentials file either.
+func (c *Config) RefreshExecRole(
+	alias string,
+	sessionDuration int32,
+	command string,
+	arguments []string,
+) error {
+	roleEnv, err := c.RoleEnv(alias)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "awssume")
+	if err != nil {
+		return fmt.Errorf(ErrCreatingFile, err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, nil, 0o600); err != nil {
+		return fmt.Errorf(ErrWritingToFile, configPath, err)
+	}
+
+	credsFile := NewCredentialsFile(&NewCredentialsFileOpts{
+		Provider: NewRoleCredentialsProvider(&NewRoleCredentialsProviderOpts{
+			Config:          c,
+			Alias:           alias,
+			SessionDuration: sessionDuration,
+		}),
+		Path:    filepath.Join(dir, "credentials"),
+		Profile: awsConfigDefaultProfile,
+	})
+
+	// Assume the Role up front, so that failures are reported before the
+	// subprocess starts
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := credsFile.Write(ctx); err != nil {
+		return err
+	}
+
+	refreshed := make(chan struct{})
+	go func() {
+		credsFile.Refresh(ctx)
+		close(refreshed)
+	}()
+
+	cmdToRun := exec.Command(command, arguments...)
+	cmdToRun.Stdin = os.Stdin
+	cmdToRun.Stdout = os.Stdout
+	cmdToRun.Stderr = os.Stderr
+	cmdToRun.Env = append(environWithout(credentialSourceEnvVars...), roleEnv.StringSlice()...)
+	cmdToRun.Env = append(cmdToRun.Env, credsFile.Env().StringSlice()...)
+	cmdToRun.Env = append(cmdToRun.Env, AWSConfigFileEnvVar+"="+configPath)
+
+	err = RunCommand(cmdToRun)
+
+	// Stop refreshing before the credentials file is removed
+	cancel()
+	<-refreshed
+
+	return err
+}
@@ -0,0 +1,228 @@
+package awssume
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeCredentialsFile(t *testing.T) {
+	creds := aws.Credentials{
+		AccessKeyID:     "AKIAskunk",
+		SecretAccessKey: "secretskunk",
+		SessionToken:    "tokenskunk",
+	}
+
+	assert.Equal(t, "[default]\n"+
+		"aws_access_key_id = AKIAskunk\n"+
+		"aws_secret_access_key = secretskunk\n"+
+		"aws_session_token = tokenskunk\n"+
+		"awssume_expiration = never\n",
+		string(MergeCredentialsFile(nil, "default", creds)),
+	)
+
+	assert.Equal(t, "# keys\n"+
+		"[badger]\n"+
+		"aws_access_key_id = AKIAbadger\n"+
+		"\n"+
+		"[skunk]\n"+
+		"region = us-east-1\n"+
+		"aws_access_key_id = AKIAskunk\n"+
+		"aws_secret_access_key = secretskunk\n"+
+		"awssume_expiration = 2020-01-02T03:04:05Z\n",
+		string(MergeCredentialsFile([]byte("# keys\n"+
+			"[badger]\n"+
+			"aws_access_key_id = AKIAbadger\n"+
+			"\n"+
+			"[skunk]\n"+
+			"region = us-east-1\n"+
+			"aws_access_key_id = old\n"+
+			"aws_session_token = old\n",
+		), "skunk", aws.Credentials{
+			AccessKeyID:     "AKIAskunk",
+			SecretAccessKey: "secretskunk",
+			CanExpire:       true,
+			Expires:         time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		})),
+	)
+}
+
+func TestCredentialsFileRefresh(t *testing.T) {
+	var mu sync.Mutex
+	retrievals := 0
+
+	credsFile := NewCredentialsFile(&NewCredentialsFileOpts{
+		Provider: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			retrievals++
+			if retrievals == 2 {
+				return aws.Credentials{}, errors.New("throttled")
+			}
+
+			return aws.Credentials{
+				AccessKeyID:     "AKIA" + strconv.Itoa(retrievals),
+				SecretAccessKey: "secret",
+				CanExpire:       true,
+				Expires:         time.Now().Add(50 * time.Millisecond),
+			}, nil
+		}),
+		Path:          filepath.Join(t.TempDir(), "credentials"),
+		Profile:       "skunk",
+		ExpiryWindow:  time.Millisecond,
+		RetryInterval: 10 * time.Millisecond,
+	})
+
+	assert.Equal(t, map[string]string{
+		AWSSharedCredentialsFileEnvVar: credsFile.GetPath(),
+		AWSProfileEnvVar:               "skunk",
+	}, credsFile.Env().m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	refreshed := make(chan struct{})
+	go func() {
+		credsFile.Refresh(ctx)
+		close(refreshed)
+	}()
+
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(credsFile.GetPath())
+		return err == nil && strings.HasPrefix(string(data), "[skunk]\n"+
+			"aws_access_key_id = AKIA3\n"+
+			"aws_secret_access_key = secret\n"+
+			"awssume_expiration = ")
+	}, 5*time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-refreshed
+}
+
+func TestConfigRefreshExecRole(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: &fakeAssumer{}}, &Role{
+		Alias: "skunk", SessionName: "skunk",
+	})
+
+	t.Setenv(AWSAccessKeyIDEnvVar, "AKIAparent")
+	t.Setenv(AWSConfigFileEnvVar, "/parent/config")
+	t.Setenv(ContainerCredentialsRelativeURIEnvVar, "/v2/credentials/parent")
+	t.Setenv(WebIdentityTokenFileEnvVar, "/parent/web-identity")
+	t.Setenv(RoleARNEnvVar, "arn:aws:iam::000000000000:role/parent")
+
+	assert.NoError(t, cfg.RefreshExecRole("skunk", 900, "sh", []string{
+		"-c", `[ -z "$AWS_ACCESS_KEY_ID" ] && [ "$AWS_PROFILE" = default ] && ` +
+			`[ -z "$AWS_CONTAINER_CREDENTIALS_RELATIVE_URI" ] && ` +
+			`[ -z "$AWS_WEB_IDENTITY_TOKEN_FILE" ] && [ -z "$AWS_ROLE_ARN" ] && ` +
+			`[ -f "$AWS_CONFIG_FILE" ] && [ ! -s "$AWS_CONFIG_FILE" ] && ` +
+			`grep -q '^aws_access_key_id = AKIAskunk$' "$AWS_SHARED_CREDENTIALS_FILE"`,
+	}))
+
+	assert.Error(t, cfg.RefreshExecRole("badger", 900, "true", nil))
+}
+
+func TestCheckCredentialsProfile(t *testing.T) {
+	data := []byte("[static]\n" +
+		"aws_access_key_id = AKIAstatic\n" +
+		"\n" +
+		"[managed]\n" +
+		"aws_access_key_id = AKIAmanaged\n" +
+		"awssume_expiration = never\n",
+	)
+
+	assert.NoError(t, CheckCredentialsProfile(data, "managed"))
+	assert.NoError(t, CheckCredentialsProfile(data, "missing"))
+	assert.ErrorIs(t, CheckCredentialsProfile(data, "static"), ErrUnmanagedProfile)
+}
+
+func TestCleanupCredentialsFile(t *testing.T) {
+	data := []byte("# keys\n" +
+		"[static]\n" +
+		"aws_access_key_id = AKIAstatic\n" +
+		"\n" +
+		"[expired]\n" +
+		"aws_access_key_id = AKIAexpired\n" +
+		"awssume_expiration = 2020-01-02T03:04:05Z\n" +
+		"\n" +
+		"[fresh]\n" +
+		"aws_access_key_id = AKIAfresh\n" +
+		"awssume_expiration = 2020-01-02T05:04:05Z\n" +
+		"\n" +
+		"[permanent]\n" +
+		"aws_access_key_id = AKIApermanent\n" +
+		"awssume_expiration = never\n",
+	)
+
+	cleaned, removed := CleanupCredentialsFile(data, time.Date(2020, 1, 2, 4, 4, 5, 0, time.UTC))
+	assert.Equal(t, []string{"expired"}, removed)
+	assert.Equal(t, "# keys\n"+
+		"[static]\n"+
+		"aws_access_key_id = AKIAstatic\n"+
+		"\n"+
+		"[fresh]\n"+
+		"aws_access_key_id = AKIAfresh\n"+
+		"awssume_expiration = 2020-01-02T05:04:05Z\n"+
+		"\n"+
+		"[permanent]\n"+
+		"aws_access_key_id = AKIApermanent\n"+
+		"awssume_expiration = never\n",
+		string(cleaned),
+	)
+}
+
+func TestWriteCredentialsProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aws", "credentials")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	assert.NoError(t, os.WriteFile(path, []byte("# keys\n"+
+		"[static]\n"+
+		"aws_access_key_id = AKIAstatic\n",
+	), 0o600))
+
+	creds := aws.Credentials{
+		AccessKeyID:     "AKIAskunk",
+		SecretAccessKey: "secretskunk",
+		CanExpire:       true,
+		Expires:         time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	assert.NoError(t, WriteCredentialsProfile(path, "skunk", creds, false))
+	assert.ErrorIs(t, WriteCredentialsProfile(path, "static", creds, false), ErrUnmanagedProfile)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# keys\n"+
+		"[static]\n"+
+		"aws_access_key_id = AKIAstatic\n"+
+		"\n"+
+		"[skunk]\n"+
+		"aws_access_key_id = AKIAskunk\n"+
+		"aws_secret_access_key = secretskunk\n"+
+		"awssume_expiration = 2020-01-02T03:04:05Z\n",
+		string(data),
+	)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	removed, err := CleanupCredentialsProfiles(path, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"skunk"}, removed)
+
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# keys\n"+
+		"[static]\n"+
+		"aws_access_key_id = AKIAstatic\n"+
+		"\n",
+		string(data),
+	)
+}
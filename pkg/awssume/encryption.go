@@ -0,0 +1,284 @@
+package awssume
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+var (
+	// ErrCiphertextTooShort is returned when encrypted data is too short to
+	// contain the header written by Seal
+	ErrCiphertextTooShort error = errors.New("ciphertext too short")
+
+	// ErrUnsupportedCiphertextVersion is returned when encrypted data was
+	// written with an unknown format version
+	ErrUnsupportedCiphertextVersion error = errors.New("unsupported ciphertext version")
+
+	// ErrDecrypt is returned when encrypted data cannot be authenticated,
+	// usually because the wrong passphrase or key file was used
+	ErrDecrypt error = errors.New("error decrypting: message authentication failed")
+
+	// ErrEmptyKey is returned when a passphrase or key file is empty
+	ErrEmptyKey error = errors.New("encryption key must not be empty")
+)
+
+const (
+	// DefaultCacheKeyFilePath is the default filesystem path, relative to the
+	// user's home directory, of the key file used to encrypt cached
+	// credentials
+	DefaultCacheKeyFilePath string = ".config/awssume.key"
+
+	// CachePassphraseEnvVar is the environment variable that, when set, holds
+	// the passphrase used to encrypt cached credentials instead of a key file
+	CachePassphraseEnvVar string = "AWSSUME_CACHE_PASSPHRASE"
+
+	// KeyFileSize is the number of random bytes written to generated key files
+	KeyFileSize int = 32
+
+	// PassphraseIterations is the number of PBKDF2-HMAC-SHA256 iterations used
+	// to derive a key from a passphrase
+	PassphraseIterations int = 600000
+
+	// ciphertextVersion is the format version written as the first byte of
+	// sealed data
+	ciphertextVersion byte = 1
+
+	// saltSize is the size of the random salt keys are derived with
+	saltSize int = 16
+
+	// keySize is the size of derived keys, selecting AES-256
+	keySize int = 32
+)
+
+// ICipher describes authenticated encryption of data at rest
+type ICipher interface {
+	// Seal encrypts and authenticates plaintext, additionally authenticating
+	// (but not encrypting) the passed additional data
+	Seal(plaintext, additionalData []byte) ([]byte, error)
+
+	// Open authenticates and decrypts data produced by Seal, given the same
+	// additional data
+	Open(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// AEADCipher implements ICipher with AES-256-GCM, using a key derived from
+// a secret and a random salt stored alongside each ciphertext. Sealed data is
+// laid out as version || salt || nonce || ciphertext.
+type AEADCipher struct {
+	// deriveKey derives an AES-256 key from the passed salt
+	deriveKey func(salt []byte) []byte
+
+	// mu guards keys and salt
+	mu sync.Mutex
+
+	// keys memoizes derived keys by salt, since derivation from a
+	// passphrase is deliberately slow
+	keys map[string][]byte
+
+	// salt is the salt used when sealing. It is generated on first use, or
+	// adopted from the first opened ciphertext, so that a single key
+	// derivation serves a whole process.
+	salt []byte
+}
+
+// Seal encrypts and authenticates plaintext
+func (c *AEADCipher) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	c.mu.Lock()
+	if c.salt == nil {
+		salt := make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+
+		c.salt = salt
+	}
+	salt := c.salt
+	c.mu.Unlock()
+
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 1+len(salt)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, ciphertextVersion)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+
+	return aead.Seal(out, nonce, plaintext, additionalData), nil
+}
+
+// Open authenticates and decrypts data produced by Seal
+func (c *AEADCipher) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < 1+saltSize {
+		return nil, ErrCiphertextTooShort
+	}
+
+	if ciphertext[0] != ciphertextVersion {
+		return nil, ErrUnsupportedCiphertextVersion
+	}
+
+	salt := ciphertext[1 : 1+saltSize]
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := ciphertext[1+saltSize:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+
+	plaintext, err := aead.Open(
+		nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], additionalData,
+	)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	c.mu.Lock()
+	if c.salt == nil {
+		c.salt = append([]byte(nil), salt...)
+	}
+	c.mu.Unlock()
+
+	return plaintext, nil
+}
+
+// aead returns the AES-GCM AEAD keyed for the passed salt
+func (c *AEADCipher) aead(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	key, ok := c.keys[string(salt)]
+	if !ok {
+		key = c.deriveKey(salt)
+		c.keys[string(salt)] = key
+	}
+	c.mu.Unlock()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+var _ ICipher = (*AEADCipher)(nil)
+
+// NewPassphraseCipher creates an AEADCipher whose keys are derived from the
+// passed passphrase with PBKDF2-HMAC-SHA256
+func NewPassphraseCipher(passphrase string) (*AEADCipher, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyKey
+	}
+
+	return &AEADCipher{
+		deriveKey: func(salt []byte) []byte {
+			return pbkdf2Key([]byte(passphrase), salt, PassphraseIterations, keySize)
+		},
+		keys: map[string][]byte{},
+	}, nil
+}
+
+// NewKeyFileCipher creates an AEADCipher whose keys are derived from the
+// contents of the key file at the passed path with HMAC-SHA256
+func NewKeyFileCipher(fs afero.Fs, keyFilePath string) (*AEADCipher, error) {
+	secret, err := afero.ReadFile(fs, keyFilePath)
+	if err != nil {
+		return nil, fmt.Errorf(ErrReadingFile, keyFilePath, err)
+	}
+
+	if len(secret) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	return &AEADCipher{
+		deriveKey: func(salt []byte) []byte {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(salt)
+			return mac.Sum(nil)
+		},
+		keys: map[string][]byte{},
+	}, nil
+}
+
+// EnsureKeyFile generates a random key file at the passed path, readable only
+// by its owner, unless one already exists
+func EnsureKeyFile(fs afero.Fs, keyFilePath string) error {
+	exists, err := afero.Exists(fs, keyFilePath)
+	if err != nil {
+		return fmt.Errorf(ErrCheckFileExists, keyFilePath, err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	key := make([]byte, KeyFileSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+
+	if err := fs.MkdirAll(path.Dir(keyFilePath), os.FileMode(0o700)); err != nil {
+		return fmt.Errorf(ErrCreatingFile, err)
+	}
+
+	if err := afero.WriteFile(fs, keyFilePath, key, os.FileMode(0o600)); err != nil {
+		return fmt.Errorf(ErrWritingToFile, keyFilePath, err)
+	}
+
+	return nil
+}
+
+// pbkdf2Key derives a key of keyLen bytes from password and salt using
+// PBKDF2 (RFC 8018) with HMAC-SHA256 as the pseudorandom function
+func pbkdf2Key(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var blockIdx [4]byte
+	derived := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(blockIdx[:], uint32(block))
+		prf.Write(blockIdx[:])
+		derived = prf.Sum(derived)
+
+		t := derived[len(derived)-hashLen:]
+		copy(u, t)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+
+	return derived[:keyLen]
+}
@@ -0,0 +1,101 @@
+package awssume
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBKDF2Key(t *testing.T) {
+	testCases := []struct {
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		keyHex     string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     64,
+			keyHex:     "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "password",
+			salt:       "salt",
+			iterations: 4096,
+			keyLen:     32,
+			keyHex:     "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		},
+	}
+
+	for _, tc := range testCases {
+		key := pbkdf2Key([]byte(tc.password), []byte(tc.salt), tc.iterations, tc.keyLen)
+		assert.Equal(t, tc.keyHex, hex.EncodeToString(key))
+	}
+}
+
+func TestPassphraseCipher(t *testing.T) {
+	_, err := NewPassphraseCipher("")
+	assert.ErrorIs(t, err, ErrEmptyKey)
+
+	c, err := NewPassphraseCipher("skunk")
+	assert.NoError(t, err)
+
+	sealed, err := c.Seal([]byte("secret"), []byte("key"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	opened, err := c.Open(sealed, []byte("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	_, err = c.Open(sealed, []byte("other"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	wrong, err := NewPassphraseCipher("badger")
+	assert.NoError(t, err)
+
+	_, err = wrong.Open(sealed, []byte("key"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestKeyFileCipher(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	_, err := NewKeyFileCipher(fs, "/awssume.key")
+	assert.Error(t, err)
+
+	assert.NoError(t, EnsureKeyFile(fs, "/awssume.key"))
+	info, err := fs.Stat("/awssume.key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(KeyFileSize), info.Size())
+
+	key, err := afero.ReadFile(fs, "/awssume.key")
+	assert.NoError(t, err)
+
+	assert.NoError(t, EnsureKeyFile(fs, "/awssume.key"))
+	unchanged, err := afero.ReadFile(fs, "/awssume.key")
+	assert.NoError(t, err)
+	assert.Equal(t, key, unchanged)
+
+	c, err := NewKeyFileCipher(fs, "/awssume.key")
+	assert.NoError(t, err)
+
+	sealed, err := c.Seal([]byte("secret"), nil)
+	assert.NoError(t, err)
+
+	opened, err := c.Open(sealed, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	_, err = c.Open(sealed[:4], nil)
+	assert.ErrorIs(t, err, ErrCiphertextTooShort)
+
+	sealed[0] = 0
+	_, err = c.Open(sealed, nil)
+	assert.ErrorIs(t, err, ErrUnsupportedCiphertextVersion)
+}
@@ -0,0 +1,71 @@
+package awssume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// ExitError is returned when an executed command does not exit successfully
+type ExitError struct {
+	// Code is the exit status of the command, or 128 plus the signal number
+	// if it was terminated by a signal, following shell convention
+	Code int
+
+	// Signal is the signal that terminated the command, or nil if it exited
+	// on its own
+	Signal os.Signal
+}
+
+// Error describes how the command terminated
+func (e *ExitError) Error() string {
+	if e.Signal != nil {
+		return fmt.Sprintf("command terminated by signal: %s", e.Signal)
+	}
+
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// RunCommand starts the passed command and waits for it to finish, forwarding
+// the signals in ForwardedSignals to it in the meantime. If the command does
+// not exit successfully, an *ExitError describing how it terminated is
+// returned.
+func RunCommand(cmd *exec.Cmd) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, ForwardedSignals...)
+	defer signal.Stop(sigChan)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf(ErrExecCmd, cmd.Path, cmd.Args[1:], err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return &ExitError{Code: 128 + int(status.Signal()), Signal: status.Signal()}
+	}
+
+	return &ExitError{Code: exitErr.ExitCode()}
+}
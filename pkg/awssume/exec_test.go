@@ -0,0 +1,45 @@
+//go:build !windows
+
+package awssume
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommand(t *testing.T) {
+	testCases := []struct {
+		script  string
+		exitErr *ExitError
+	}{
+		{
+			script:  "exit 0",
+			exitErr: nil,
+		},
+		{
+			script:  "exit 3",
+			exitErr: &ExitError{Code: 3},
+		},
+		{
+			script:  "kill -TERM $$",
+			exitErr: &ExitError{Code: 128 + int(syscall.SIGTERM), Signal: syscall.SIGTERM},
+		},
+	}
+
+	for _, tc := range testCases {
+		err := RunCommand(exec.Command("sh", "-c", tc.script))
+		if tc.exitErr == nil {
+			assert.NoError(t, err)
+			continue
+		}
+
+		var exitErr *ExitError
+		assert.ErrorAs(t, err, &exitErr)
+		assert.Equal(t, tc.exitErr, exitErr)
+	}
+
+	assert.Error(t, RunCommand(exec.Command("/nonexistent/skunk")))
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package awssume
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ForwardedSignals are the signals relayed to commands run by RunCommand
+var ForwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// Propagate terminates the current process the same way the command
+// terminated: by re-raising the signal that killed it, or by exiting with its
+// exit status
+func (e *ExitError) Propagate() {
+	if sig, ok := e.Signal.(syscall.Signal); ok {
+		signal.Reset(sig)
+		if err := syscall.Kill(syscall.Getpid(), sig); err == nil {
+			// Give the signal a chance to be delivered before falling back
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	os.Exit(e.Code)
+}
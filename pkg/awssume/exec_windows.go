@@ -0,0 +1,14 @@
+//go:build windows
+
+package awssume
+
+import (
+	"os"
+	"syscall"
+)
+
+// ForwardedSignals are the signals relayed to commands run by RunCommand
+var ForwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// Propagate terminates the current process with the command's exit status
+func (e *ExitError) Propagate() { os.Exit(e.Code) }
@@ -0,0 +1,171 @@
+package awssume
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var (
+	// ErrFileLocked is returned when a file stays locked by another process
+	// for longer than the lock timeout
+	ErrFileLocked error = errors.New("file is locked by another process")
+
+	// ErrConfigModified is returned when the configuration file was changed
+	// by someone else between loading and saving the configuration
+	ErrConfigModified error = errors.New("configuration file was modified since it was loaded")
+)
+
+const (
+	// DefaultLockTimeout is how long to wait for another process to release
+	// a file lock
+	DefaultLockTimeout time.Duration = 10 * time.Second
+
+	// lockFileSuffix is appended to the path of a locked file, without the
+	// extension in the case of the configuration, to form the path of its
+	// lock file
+	lockFileSuffix string = ".lock"
+
+	// lockRetryInterval is how long to wait before trying to take a held lock
+	// again
+	lockRetryInterval time.Duration = 50 * time.Millisecond
+)
+
+// writeFileAtomic writes data to a temporary file next to the named file and
+// renames it into place, so that readers never see a partially written file.
+// On the OS filesystem, both the file and its directory are synced so that
+// the write survives a crash, and a symbolic link at the named path is
+// followed, so that its target is written instead of the link replaced.
+func writeFileAtomic(fs afero.Fs, name string, data []byte, perm os.FileMode) error {
+	_, isOsFs := fs.(*afero.OsFs)
+	if isOsFs {
+		if resolved, err := filepath.EvalSymlinks(name); err == nil {
+			name = resolved
+		}
+	}
+
+	tmp, err := afero.TempFile(fs, filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf(ErrCreatingFile, err)
+	}
+	defer fs.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf(ErrWritingToFile, tmp.Name(), err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf(ErrWritingToFile, tmp.Name(), err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf(ErrWritingToFile, tmp.Name(), err)
+	}
+
+	if err := fs.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf(ErrWritingToFile, tmp.Name(), err)
+	}
+
+	if err := fs.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf(ErrWritingToFile, name, err)
+	}
+
+	if isOsFs {
+		if err := syncDir(filepath.Dir(name)); err != nil {
+			return fmt.Errorf(ErrWritingToFile, filepath.Dir(name), err)
+		}
+	}
+
+	return nil
+}
+
+// editFileAtomic replaces the contents of the named file on the OS filesystem
+// with the result of passing its current contents, which are nil if it does
+// not exist, to edit. The file is locked while it is edited, so that
+// concurrent edits are not lost, and written atomically with the passed
+// permissions. Its directory is created if it does not exist.
+func editFileAtomic(name string, perm os.FileMode, edit func([]byte) ([]byte, error)) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return fmt.Errorf(ErrCreatingFile, err)
+	}
+
+	lock, err := lockFile(name+lockFileSuffix, DefaultLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	data, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf(ErrReadingFile, name, err)
+	}
+
+	edited, err := edit(data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(afero.NewOsFs(), name, edited, perm)
+}
+
+// fileChecksum returns the checksum of the named file's contents, which is
+// that of empty contents if the file does not exist
+func fileChecksum(fs afero.Fs, name string) ([sha256.Size]byte, error) {
+	data, err := afero.ReadFile(fs, name)
+	if err != nil && !os.IsNotExist(err) {
+		return [sha256.Size]byte{}, fmt.Errorf(ErrReadingFile, name, err)
+	}
+
+	return sha256.Sum256(data), nil
+}
+
+// fileLock is an exclusive advisory lock held on an open lock file
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile takes an exclusive advisory lock on the named file, creating it
+// if needed, and waiting up to timeout for other processes to release it
+func lockFile(name string, timeout time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf(ErrLockFile, name, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf(ErrLockFile, name, err)
+		}
+
+		if locked {
+			return &fileLock{f: f}, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf(ErrLockFile, name, ErrFileLocked)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() error {
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+
+	return l.f.Close()
+}
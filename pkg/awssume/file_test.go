@@ -0,0 +1,72 @@
+package awssume
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/dir/file", []byte("old"), 0o644))
+
+	assert.NoError(t, writeFileAtomic(fs, "/dir/file", []byte("new"), 0o600))
+
+	data, err := afero.ReadFile(fs, "/dir/file")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	info, err := fs.Stat("/dir/file")
+	assert.NoError(t, err)
+	assert.Equal(t, "-rw-------", info.Mode().String())
+
+	entries, err := afero.ReadDir(fs, "/dir")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	assert.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+
+	assert.NoError(t, writeFileAtomic(afero.NewOsFs(), link, []byte("new"), 0o600))
+
+	info, err := os.Lstat(link)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	data, err := os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestConfigLock(t *testing.T) {
+	opts := &NewConfigOpts{
+		Fs:          afero.NewOsFs(),
+		Path:        filepath.Join(t.TempDir(), "awssume"),
+		Lock:        true,
+		LockTimeout: 100 * time.Millisecond,
+	}
+
+	cfg, err := NewConfig(opts)
+	assert.NoError(t, err)
+
+	_, err = NewConfig(opts)
+	assert.ErrorIs(t, err, ErrFileLocked)
+
+	assert.NoError(t, cfg.Close())
+	assert.NoError(t, cfg.Close())
+
+	cfg, err = NewConfig(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Close())
+}
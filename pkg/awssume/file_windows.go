@@ -0,0 +1,60 @@
+//go:build windows
+
+package awssume
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	// lockfileFailImmediately makes LockFileEx return instead of waiting for
+	// a held lock
+	lockfileFailImmediately uintptr = 0x1
+
+	// lockfileExclusiveLock makes LockFileEx take an exclusive lock
+	lockfileExclusiveLock uintptr = 0x2
+
+	// errorLockViolation is returned by LockFileEx when the lock is held
+	errorLockViolation syscall.Errno = 33
+)
+
+// tryLockFile takes an exclusive advisory lock on the passed file without
+// blocking, reporting whether it could be taken
+func tryLockFile(f *os.File) (bool, error) {
+	ol := new(syscall.Overlapped)
+	r, _, err := procLockFileEx.Call(
+		f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(ol)),
+	)
+	if r != 0 {
+		return true, nil
+	}
+
+	if err == errorLockViolation {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// unlockFile releases the lock held on the passed file
+func unlockFile(f *os.File) error {
+	ol := new(syscall.Overlapped)
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// syncDir does nothing, since directories cannot be synced on Windows, where
+// renames are made durable by the filesystem's journal
+func syncDir(string) error { return nil }
@@ -0,0 +1,187 @@
+package awssume
+
+import (
+	"bytes"
+	"strings"
+)
+
+// iniFile is a parsed INI file, in the dialect of the shared AWS config and
+// credentials files. It keeps every line it was parsed from, so that it can
+// be written back with unrelated sections, comments and formatting intact.
+type iniFile struct {
+	// sections holds the file's sections in order. The first section has an
+	// empty name and no header, and holds the lines preceding the first
+	// section header.
+	sections []*iniSection
+
+	// newline is the line ending of the file's first line, which lines added
+	// to the file are ended with
+	newline string
+}
+
+// iniSection is a named section of an INI file
+type iniSection struct {
+	// name is the section name, i.e. the header without its brackets
+	name string
+
+	// lines holds the section's lines, including its header
+	lines []*iniLine
+}
+
+// iniLine is a single line of an INI file
+type iniLine struct {
+	// raw is the line as it appears in the file, without its line ending
+	raw string
+
+	// eol is the line's original line ending, and is empty for added lines
+	// and an unterminated last line
+	eol string
+
+	// key is the key of a key/value line, and is empty for headers,
+	// comments, blank lines and indented continuation lines
+	key string
+
+	// value is the value of a key/value line
+	value string
+}
+
+// parseINI parses the passed INI file contents. Lines it does not recognize
+// are kept as-is, and so are line endings.
+func parseINI(data []byte) *iniFile {
+	f := &iniFile{sections: []*iniSection{{}}}
+	cur := f.sections[0]
+
+	for _, raw := range strings.SplitAfter(string(data), "\n") {
+		if raw == "" {
+			continue
+		}
+
+		line := &iniLine{raw: strings.TrimRight(raw, "\r\n")}
+		line.eol = raw[len(line.raw):]
+		if f.newline == "" && line.eol != "" {
+			f.newline = line.eol
+		}
+
+		raw = line.raw
+		trimmed := strings.TrimSpace(raw)
+
+		switch {
+		case strings.HasPrefix(trimmed, "[") && strings.Contains(trimmed, "]"):
+			cur = &iniSection{name: strings.TrimSpace(trimmed[1:strings.Index(trimmed, "]")])}
+			f.sections = append(f.sections, cur)
+		case trimmed == "", trimmed[0] == '#', trimmed[0] == ';', raw[0] == ' ', raw[0] == '\t':
+		default:
+			if i := strings.Index(trimmed, "="); i > 0 {
+				line.key = strings.TrimSpace(trimmed[:i])
+				line.value = strings.TrimSpace(trimmed[i+1:])
+			}
+		}
+
+		cur.lines = append(cur.lines, line)
+	}
+
+	return f
+}
+
+// section returns the first section with the passed name, or nil if there is
+// none
+func (f *iniFile) section(name string) *iniSection {
+	for _, s := range f.sections[1:] {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// get returns the value of the first line with the passed key
+func (s *iniSection) get(key string) (string, bool) {
+	for _, line := range s.lines {
+		if line.key == key {
+			return line.value, true
+		}
+	}
+
+	return "", false
+}
+
+// addSection appends a new, empty section with the passed name, separated
+// from the preceding lines by a blank line
+func (f *iniFile) addSection(name string) *iniSection {
+	if last := f.sections[len(f.sections)-1]; len(last.lines) > 0 &&
+		strings.TrimSpace(last.lines[len(last.lines)-1].raw) != "" {
+		last.lines = append(last.lines, &iniLine{})
+	}
+
+	s := &iniSection{name: name, lines: []*iniLine{{raw: "[" + name + "]"}}}
+	f.sections = append(f.sections, s)
+
+	return s
+}
+
+// removeSection removes the first section with the passed name, along with
+// its lines
+func (f *iniFile) removeSection(name string) {
+	for i, s := range f.sections[1:] {
+		if s.name == name {
+			f.sections = append(f.sections[:i+1], f.sections[i+2:]...)
+			return
+		}
+	}
+}
+
+// bytes renders the file, terminating every line with its original line
+// ending, or that of the file's first line if it has none
+func (f *iniFile) bytes() []byte {
+	newline := f.newline
+	if newline == "" {
+		newline = "\n"
+	}
+
+	var buf bytes.Buffer
+	for _, s := range f.sections {
+		for _, line := range s.lines {
+			buf.WriteString(line.raw)
+			if line.eol != "" {
+				buf.WriteString(line.eol)
+			} else {
+				buf.WriteString(newline)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// set sets the value of the first line with the passed key, or adds a line
+// after the section's last non-blank line if there is none
+func (s *iniSection) set(key, value string) {
+	line := &iniLine{raw: key + " = " + value, key: key, value: value}
+
+	for i, l := range s.lines {
+		if l.key == key {
+			s.lines[i] = line
+			return
+		}
+	}
+
+	i := len(s.lines)
+	for i > 1 && strings.TrimSpace(s.lines[i-1].raw) == "" {
+		i--
+	}
+
+	s.lines = append(s.lines[:i], append([]*iniLine{line}, s.lines[i:]...)...)
+}
+
+// unset removes every line with the passed key
+func (s *iniSection) unset(key string) {
+	lines := s.lines[:0]
+	for _, l := range s.lines {
+		if l.key != key {
+			lines = append(lines, l)
+		}
+	}
+
+	s.lines = lines
+}
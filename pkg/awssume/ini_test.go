@@ -0,0 +1,100 @@
+package awssume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseINI(t *testing.T) {
+	f := parseINI([]byte("# preamble\r\n" +
+		"[default]\n" +
+		"region = us-east-1\n" +
+		"\n" +
+		"[profile skunk]  \n" +
+		"; comment\n" +
+		"role_arn=arn:aws:iam::000000000000:role/skunk\n" +
+		"s3 =\n" +
+		"  max_concurrent_requests = 20\n" +
+		"garbage\n",
+	))
+
+	assert.Len(t, f.sections, 3)
+	assert.Equal(t, "", f.sections[0].name)
+	assert.Equal(t, "# preamble", f.sections[0].lines[0].raw)
+
+	region, ok := f.section("default").get("region")
+	assert.True(t, ok)
+	assert.Equal(t, "us-east-1", region)
+
+	skunk := f.section("profile skunk")
+	assert.Len(t, skunk.lines, 6)
+	roleARN, ok := skunk.get("role_arn")
+	assert.True(t, ok)
+	assert.Equal(t, "arn:aws:iam::000000000000:role/skunk", roleARN)
+	_, ok = skunk.get("max_concurrent_requests")
+	assert.False(t, ok)
+	_, ok = skunk.get("garbage")
+	assert.False(t, ok)
+
+	assert.Nil(t, f.section("profile badger"))
+}
+
+func TestINIFileEdit(t *testing.T) {
+	f := parseINI([]byte("# preamble\n" +
+		"[profile skunk]\n" +
+		"region = us-east-1\n" +
+		"role_arn = old\n" +
+		"\n" +
+		"[profile badger]\n" +
+		"region = us-west-2",
+	))
+
+	skunk := f.section("profile skunk")
+	skunk.set("role_arn", "new")
+	skunk.set("external_id", "external")
+	skunk.unset("region")
+
+	ferret := f.addSection("profile ferret")
+	ferret.set("role_arn", "ferret")
+
+	f.removeSection("profile badger")
+	f.removeSection("profile weasel")
+
+	assert.Equal(t, "# preamble\n"+
+		"[profile skunk]\n"+
+		"role_arn = new\n"+
+		"external_id = external\n"+
+		"\n"+
+		"[profile ferret]\n"+
+		"role_arn = ferret\n",
+		string(f.bytes()),
+	)
+}
+
+func TestINIFileEditLineEndings(t *testing.T) {
+	f := parseINI([]byte("# preamble\r\n" +
+		"[profile skunk]\r\n" +
+		"role_arn = old\r\n" +
+		"region = us-east-1\n" +
+		"\r\n" +
+		"[profile badger]\r\n" +
+		"region = us-west-2",
+	))
+
+	f.section("profile skunk").set("role_arn", "new")
+	f.addSection("profile ferret").set("role_arn", "ferret")
+
+	assert.Equal(t, "# preamble\r\n"+
+		"[profile skunk]\r\n"+
+		"role_arn = new\r\n"+
+		"region = us-east-1\n"+
+		"\r\n"+
+		"[profile badger]\r\n"+
+		"region = us-west-2\r\n"+
+		"\r\n"+
+		"[profile ferret]\r\n"+
+		"role_arn = ferret\r\n",
+		string(f.bytes()),
+	)
+}
@@ -0,0 +1,86 @@
+package awssume
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// TokenProvider returns an MFA token code for the passed MFA device serial
+// number (or ARN)
+type TokenProvider func(mfaSerial string) (string, error)
+
+// StaticTokenProvider returns a TokenProvider that always returns the passed
+// token code
+func StaticTokenProvider(tokenCode string) TokenProvider {
+	return func(string) (string, error) {
+		if err := ValidateTokenCode(tokenCode); err != nil {
+			return "", err
+		}
+
+		return tokenCode, nil
+	}
+}
+
+// ReaderTokenProvider returns a TokenProvider that reads a single line from
+// in per token code, writing a prompt naming the MFA device to out first if
+// out is not nil
+func ReaderTokenProvider(in io.Reader, out io.Writer) TokenProvider {
+	// Buffered input is kept between calls, e.g. for the later hops of a Role
+	// chain
+	reader := bufio.NewReader(in)
+
+	return func(mfaSerial string) (string, error) {
+		if out != nil {
+			fmt.Fprintf(out, "Enter MFA code for %s: ", mfaSerial)
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			return "", fmt.Errorf(ErrReadingTokenCode, err)
+		}
+
+		tokenCode := strings.TrimSpace(line)
+		if err := ValidateTokenCode(tokenCode); err != nil {
+			return "", err
+		}
+
+		return tokenCode, nil
+	}
+}
+
+// TerminalTokenProvider returns a TokenProvider that prompts for token codes
+// on the terminal device at ttyPath, falling back to reading them from in and
+// prompting on out when it cannot be opened, e.g. because there is no
+// controlling terminal. The fallback keeps buffered input between calls.
+func TerminalTokenProvider(ttyPath string, in io.Reader, out io.Writer) TokenProvider {
+	fallback := ReaderTokenProvider(in, out)
+
+	return func(mfaSerial string) (string, error) {
+		tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+		if err != nil {
+			return fallback(mfaSerial)
+		}
+		defer tty.Close()
+
+		return ReaderTokenProvider(tty, tty)(mfaSerial)
+	}
+}
+
+// ValidateTokenCode checks that the passed token code is shaped like an MFA
+// token code, which STS requires to be exactly six digits
+func ValidateTokenCode(tokenCode string) error {
+	if len(tokenCode) != 6 {
+		return ErrInvalidTokenCode
+	}
+
+	for _, c := range tokenCode {
+		if c < '0' || c > '9' {
+			return ErrInvalidTokenCode
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package awssume
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTokenCode(t *testing.T) {
+	testCases := []struct {
+		tokenCode   string
+		errExpected bool
+	}{
+		{tokenCode: "123456", errExpected: false},
+		{tokenCode: "12345", errExpected: true},
+		{tokenCode: "1234567", errExpected: true},
+		{tokenCode: "12345a", errExpected: true},
+		{tokenCode: "", errExpected: true},
+	}
+
+	for _, tc := range testCases {
+		err := ValidateTokenCode(tc.tokenCode)
+		if tc.errExpected {
+			assert.ErrorIs(t, err, ErrInvalidTokenCode)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestStaticTokenProvider(t *testing.T) {
+	tokenCode, err := StaticTokenProvider("123456")("arn:aws:iam::000000000000:mfa/skunk")
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", tokenCode)
+
+	_, err = StaticTokenProvider("skunk")("arn:aws:iam::000000000000:mfa/skunk")
+	assert.ErrorIs(t, err, ErrInvalidTokenCode)
+}
+
+func TestReaderTokenProvider(t *testing.T) {
+	testCases := []struct {
+		input       string
+		tokenCode   string
+		errExpected bool
+	}{
+		{input: "123456\n", tokenCode: "123456", errExpected: false},
+		{input: " 654321 \r\n", tokenCode: "654321", errExpected: false},
+		{input: "123456", tokenCode: "123456", errExpected: false},
+		{input: "", tokenCode: "", errExpected: true},
+		{input: "skunk\n", tokenCode: "", errExpected: true},
+	}
+
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		tokenCode, err := ReaderTokenProvider(
+			strings.NewReader(tc.input), out,
+		)("arn:aws:iam::000000000000:mfa/skunk")
+		if tc.errExpected {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.tokenCode, tokenCode)
+		assert.Contains(t, out.String(), "arn:aws:iam::000000000000:mfa/skunk")
+	}
+}
+
+func TestReaderTokenProviderConsecutive(t *testing.T) {
+	provider := ReaderTokenProvider(strings.NewReader("111111\n222222\n"), nil)
+
+	tokenCode, err := provider("arn:aws:iam::000000000000:mfa/skunk")
+	assert.NoError(t, err)
+	assert.Equal(t, "111111", tokenCode)
+
+	tokenCode, err = provider("arn:aws:iam::000000000000:mfa/badger")
+	assert.NoError(t, err)
+	assert.Equal(t, "222222", tokenCode)
+
+	_, err = provider("arn:aws:iam::000000000000:mfa/ferret")
+	assert.Error(t, err)
+}
+
+func TestTerminalTokenProviderFallback(t *testing.T) {
+	assumer := &fakeAssumer{}
+	cfg := newTestConfig(t, &NewConfigOpts{
+		Assumer: assumer,
+		TokenProvider: TerminalTokenProvider(
+			filepath.Join(t.TempDir(), "tty"),
+			strings.NewReader("111111\n222222\n"),
+			io.Discard,
+		),
+	}, &Role{
+		Alias:       "bastion",
+		SessionName: "bastion",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/bastion",
+	}, &Role{
+		Alias:       "workload",
+		SessionName: "workload",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/workload",
+		SourceRole:  "bastion",
+	})
+
+	_, err := cfg.AssumeRole("workload", 900)
+	assert.NoError(t, err)
+	assert.Len(t, assumer.inputs, 2)
+	assert.Equal(t, "111111", aws.ToString(assumer.inputs[0].TokenCode))
+	assert.Equal(t, "222222", aws.ToString(assumer.inputs[1].TokenCode))
+}
@@ -0,0 +1,184 @@
+package awssume
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/naoina/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfigVersion is returned when the configuration schema version
+// is not a number
+var ErrInvalidConfigVersion error = errors.New("configuration version must be a number")
+
+const (
+	// ConfigVersion is the configuration schema version written by this
+	// version of awssume, i.e. the version of the last registered migration
+	ConfigVersion int = 2
+
+	// configVersionKey is the top-level configuration key holding the
+	// schema version
+	configVersionKey string = "version"
+
+	// configBackupSuffix is appended, with the schema version, to the path
+	// of a configuration file backed up before it is overwritten with a
+	// migrated configuration
+	configBackupSuffix string = ".v%d.bak"
+)
+
+// Migration upgrades configuration documents by one schema version
+type Migration struct {
+	// Version is the schema version the migration upgrades documents to
+	Version int
+
+	// Description summarizes the changes the migration makes
+	Description string
+
+	// Migrate upgrades the passed document, as decoded from any of the
+	// configuration formats, in place
+	Migrate func(doc map[string]interface{}) error
+}
+
+// migrations is the registry of configuration migrations, in version order.
+// Documents without a version are at version 0.
+var migrations = []*Migration{
+	{
+		Version:     1,
+		Description: "record the configuration schema version",
+		Migrate:     func(doc map[string]interface{}) error { return nil },
+	},
+	{
+		Version:     2,
+		Description: "store Role ARNs as strings",
+		Migrate:     migrateRoleARNStrings,
+	},
+}
+
+// migrateRoleARNStrings replaces Role ARNs stored as objects, either holding
+// the ARN under an "arn" key, as JSON configurations were written by hand,
+// or holding its parts under an "a_r_n" key, as TOML configurations were
+// written, with their string form
+func migrateRoleARNStrings(doc map[string]interface{}) error {
+	roles, _ := doc["roles"].([]interface{})
+	for _, role := range roles {
+		r, ok := role.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		legacy, ok := r["arn"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if s, ok := legacy["arn"].(string); ok {
+			r["arn"] = s
+			continue
+		}
+
+		if parts, ok := legacy["a_r_n"].(map[string]interface{}); ok {
+			part := func(key string) string {
+				s, _ := parts[key].(string)
+				return s
+			}
+
+			r["arn"] = arn.ARN{
+				Partition: part("partition"),
+				Service:   part("service"),
+				Region:    part("region"),
+				AccountID: part("account_id"),
+				Resource:  part("resource"),
+			}.String()
+		}
+	}
+
+	return nil
+}
+
+// MigrationsFrom returns the migrations that upgrade configuration documents
+// at the passed schema version to ConfigVersion, in the order they apply
+func MigrationsFrom(version int) []*Migration {
+	pending := []*Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// migrateConfig upgrades the passed configuration file contents, in the
+// passed format, to ConfigVersion. It returns the upgraded contents and the
+// schema version they were upgraded from, which is ConfigVersion if they
+// were already up to date.
+func migrateConfig(data []byte, format ConfigFormat) ([]byte, int, error) {
+	var marshalFn func(interface{}) ([]byte, error)
+	var unmarshalFn func([]byte, interface{}) error
+	switch format {
+	case JSON:
+		marshalFn, unmarshalFn = json.Marshal, json.Unmarshal
+	case TOML:
+		marshalFn, unmarshalFn = toml.Marshal, toml.Unmarshal
+	case YAML:
+		marshalFn, unmarshalFn = yaml.Marshal, yaml.Unmarshal
+	default:
+		return nil, 0, ErrUnsupportedConfigFormat
+	}
+
+	doc := map[string]interface{}{}
+	if err := unmarshalFn(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf(ErrUnmarshal, err)
+	}
+
+	version, err := docVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version > ConfigVersion {
+		return nil, 0, fmt.Errorf(ErrConfigVersion, version, ConfigVersion)
+	}
+
+	pending := MigrationsFrom(version)
+	if len(pending) == 0 {
+		return data, version, nil
+	}
+
+	for _, m := range pending {
+		if err := m.Migrate(doc); err != nil {
+			return nil, 0, fmt.Errorf(ErrMigrateConfig, m.Version, err)
+		}
+
+		doc[configVersionKey] = m.Version
+	}
+
+	migrated, err := marshalFn(doc)
+	if err != nil {
+		return nil, 0, fmt.Errorf(ErrMarshal, err)
+	}
+
+	return migrated, version, nil
+}
+
+// docVersion returns the schema version of the passed configuration
+// document, whose numbers are decoded as different types by each format
+func docVersion(doc map[string]interface{}) (int, error) {
+	switch v := doc[configVersionKey].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf(ErrUnmarshal, ErrInvalidConfigVersion)
+	}
+}
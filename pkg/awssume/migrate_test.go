@@ -0,0 +1,111 @@
+package awssume
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+	}
+
+	assert.Equal(t, ConfigVersion, migrations[len(migrations)-1].Version)
+	assert.Len(t, MigrationsFrom(0), ConfigVersion)
+	assert.Empty(t, MigrationsFrom(ConfigVersion))
+}
+
+func TestMigrateConfig(t *testing.T) {
+	for _, tc := range []struct {
+		format   ConfigFormat
+		data     string
+		expected string
+	}{
+		{format: JSON, data: `{"roles":[]}`, expected: `{"roles":[],"version":2}`},
+		{format: TOML, data: "roles = []\n", expected: "roles = []\nversion = 2\n"},
+		{format: YAML, data: "roles: []\n", expected: "roles: []\nversion: 2\n"},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			migrated, version, err := migrateConfig([]byte(tc.data), tc.format)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, version)
+			assert.Equal(t, tc.expected, string(migrated))
+
+			upToDate, version, err := migrateConfig(migrated, tc.format)
+			assert.NoError(t, err)
+			assert.Equal(t, ConfigVersion, version)
+			assert.Equal(t, migrated, upToDate)
+		})
+	}
+
+	_, _, err := migrateConfig([]byte("version: 99\n"), YAML)
+	assert.EqualError(t, err, "configuration version 99 is newer than the supported version 2")
+
+	_, _, err = migrateConfig([]byte("version: one\n"), YAML)
+	assert.ErrorIs(t, err, ErrInvalidConfigVersion)
+}
+
+func TestMigrateRoleARNStrings(t *testing.T) {
+	for _, tc := range []struct {
+		format ConfigFormat
+		data   string
+	}{
+		{
+			format: JSON,
+			data: `{"version":1,"roles":[{"alias":"skunk",` +
+				`"arn":{"arn":"arn:aws:iam::000000000000:role/skunk"},"session_name":"skunk"}]}`,
+		},
+		{
+			format: TOML,
+			data: "version = 1\n\n[[roles]]\nalias = \"skunk\"\nsession_name = \"skunk\"\n\n" +
+				"[roles.arn.a_r_n]\npartition = \"aws\"\nservice = \"iam\"\nregion = \"\"\n" +
+				"account_id = \"000000000000\"\nresource = \"role/skunk\"\n",
+		},
+		{
+			format: YAML,
+			data: "version: 1\nroles:\n- alias: skunk\n" +
+				"  arn: arn:aws:iam::000000000000:role/skunk\n  session_name: skunk\n",
+		},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(fs, "/awssume."+tc.format.String(), []byte(tc.data), 0o600))
+
+			cfg, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, cfg.GetLoadedVersion())
+
+			r, err := cfg.GetRoleByAlias("skunk")
+			assert.NoError(t, err)
+			assert.Equal(t, "arn:aws:iam::000000000000:role/skunk", r.GetARN().String())
+		})
+	}
+}
+
+func TestNewConfigMigrate(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	original := "roles:\n" +
+		"  - alias: skunk\n" +
+		"    arn: arn:aws:iam::000000000000:role/skunk\n" +
+		"    session_name: skunk\n"
+	assert.NoError(t, afero.WriteFile(fs, "/awssume.yaml", []byte(original), 0o600))
+
+	cfg, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.GetLoadedVersion())
+	assert.Equal(t, ConfigVersion, cfg.Version)
+	assert.Len(t, cfg.Roles, 1)
+
+	assert.NoError(t, cfg.Save())
+
+	backup, err := afero.ReadFile(fs, "/awssume.yaml.v0.bak")
+	assert.NoError(t, err)
+	assert.Equal(t, original, string(backup))
+
+	loaded, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+	assert.NoError(t, err)
+	assert.Equal(t, ConfigVersion, loaded.GetLoadedVersion())
+	assert.Equal(t, cfg.Roles, loaded.Roles)
+}
@@ -0,0 +1,68 @@
+package awssume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+var (
+	// ErrInvalidPolicy is returned when a session policy is not a JSON
+	// object
+	ErrInvalidPolicy error = errors.New("session policy is not a JSON object")
+
+	// ErrTooManyPolicyARNs is returned when more managed session policies
+	// are specified than STS accepts
+	ErrTooManyPolicyARNs error = errors.New("too many managed session policy ARNs")
+)
+
+const (
+	// MaxPolicyLength is the maximum number of characters STS accepts in an
+	// inline session policy, after insignificant whitespace is removed
+	MaxPolicyLength int = 2048
+
+	// MaxPolicyARNs is the maximum number of managed session policies STS
+	// accepts
+	MaxPolicyARNs int = 10
+)
+
+// CompactPolicy checks that the passed inline session policy is a JSON
+// object that fits into STS's size limit, and returns it with insignificant
+// whitespace removed
+func CompactPolicy(policy string) (string, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(policy), &document); err != nil || document == nil {
+		return "", ErrInvalidPolicy
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(policy)); err != nil {
+		return "", ErrInvalidPolicy
+	}
+
+	if n := utf8.RuneCount(buf.Bytes()); n > MaxPolicyLength {
+		return "", fmt.Errorf(ErrPolicyTooLong, n, MaxPolicyLength)
+	}
+
+	return buf.String(), nil
+}
+
+// ValidatePolicyARNs checks that the passed managed session policy ARNs are
+// well-formed and no more numerous than STS accepts
+func ValidatePolicyARNs(policyARNs []string) error {
+	if len(policyARNs) > MaxPolicyARNs {
+		return ErrTooManyPolicyARNs
+	}
+
+	for _, policyARN := range policyARNs {
+		if _, err := arn.Parse(policyARN); err != nil {
+			return fmt.Errorf(ErrPolicyARN, policyARN, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package awssume
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactPolicy(t *testing.T) {
+	statement := `{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}`
+
+	testCases := []struct {
+		policy      string
+		compacted   string
+		errExpected bool
+	}{
+		{
+			policy:    "{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [" + statement + "]\n}\n",
+			compacted: `{"Version":"2012-10-17","Statement":[` + statement + `]}`,
+		},
+		{policy: `{"Version": "2012-10-17"`, errExpected: true},
+		{policy: "", errExpected: true},
+		{policy: "123", errExpected: true},
+		{policy: `"x"`, errExpected: true},
+		{policy: "[]", errExpected: true},
+		{policy: "null", errExpected: true},
+		{
+			policy:      `{"Statement":[` + strings.Repeat(statement+",", 40) + statement + `]}`,
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		compacted, err := CompactPolicy(tc.policy)
+		if tc.errExpected {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.compacted, compacted)
+	}
+}
+
+func TestValidatePolicyARNs(t *testing.T) {
+	assert.NoError(t, ValidatePolicyARNs(nil))
+	assert.NoError(t, ValidatePolicyARNs([]string{
+		"arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"arn:aws:iam::000000000000:policy/skunk",
+	}))
+	assert.EqualError(
+		t,
+		ValidatePolicyARNs([]string{"ReadOnlyAccess"}),
+		"invalid session policy ARN ReadOnlyAccess: arn: invalid prefix",
+	)
+
+	policyARNs := make([]string, MaxPolicyARNs+1)
+	for i := range policyARNs {
+		policyARNs[i] = "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	}
+	assert.ErrorIs(t, ValidatePolicyARNs(policyARNs), ErrTooManyPolicyARNs)
+}
@@ -0,0 +1,49 @@
+package awssume
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// RoleCredentialsProvider implements aws.CredentialsProvider by assuming a
+// configured Role, so that it can be used with any AWS SDK client. It is
+// meant to be wrapped with aws.NewCredentialsCache, which reuses the returned
+// credentials until they expire.
+type RoleCredentialsProvider struct {
+	// config holds the configured Roles
+	config IConfig
+
+	// alias is the alias of the Role to assume
+	alias string
+
+	// sessionDuration is the duration of the STS Session in seconds
+	sessionDuration int32
+}
+
+// Retrieve assumes the Role and returns its temporary credentials
+func (p *RoleCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return p.config.AssumeRoleWithContext(ctx, p.alias, p.sessionDuration)
+}
+
+var _ aws.CredentialsProvider = (*RoleCredentialsProvider)(nil)
+
+// NewRoleCredentialsProviderOpts is an option set passed to the Role
+// credentials provider constructor
+type NewRoleCredentialsProviderOpts struct {
+	Config IConfig
+	Alias  string
+
+	// SessionDuration is the duration of the STS Session in seconds. The
+	// Role's default duration is used if it is zero.
+	SessionDuration int32
+}
+
+// NewRoleCredentialsProvider creates a new RoleCredentialsProvider
+func NewRoleCredentialsProvider(opts *NewRoleCredentialsProviderOpts) *RoleCredentialsProvider {
+	return &RoleCredentialsProvider{
+		config:          opts.Config,
+		alias:           opts.Alias,
+		sessionDuration: opts.SessionDuration,
+	}
+}
@@ -0,0 +1,57 @@
+package awssume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAssumeConfig is a Config whose Roles are "assumed" by returning fixed
+// credentials and counting calls
+type fakeAssumeConfig struct {
+	*Config
+
+	creds aws.Credentials
+	calls int
+}
+
+func (f *fakeAssumeConfig) AssumeRoleWithContext(
+	ctx context.Context,
+	alias string,
+	sessionDuration int32,
+) (aws.Credentials, error) {
+	f.calls++
+	return f.creds, nil
+}
+
+func TestRoleCredentialsProvider(t *testing.T) {
+	cfg := &fakeAssumeConfig{
+		Config: &Config{},
+		creds: aws.Credentials{
+			AccessKeyID:     "AKIA",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Source:          CredentialsSource,
+			CanExpire:       true,
+			Expires:         time.Now().Add(time.Hour),
+		},
+	}
+
+	provider := NewRoleCredentialsProvider(&NewRoleCredentialsProviderOpts{
+		Config: cfg, Alias: "skunk",
+	})
+	assert.Zero(t, provider.sessionDuration)
+
+	cache := aws.NewCredentialsCache(provider)
+	for i := 0; i < 3; i++ {
+		creds, err := cache.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "AKIA", creds.AccessKeyID)
+		assert.True(t, creds.CanExpire)
+	}
+
+	assert.Equal(t, 1, cfg.calls)
+}
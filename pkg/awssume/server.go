@@ -0,0 +1,308 @@
+package awssume
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// ContainerCredentialsFullURIEnvVar is the environment variable AWS SDKs
+	// read the URL of a container credentials endpoint from
+	ContainerCredentialsFullURIEnvVar string = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+
+	// ContainerAuthorizationTokenEnvVar is the environment variable AWS SDKs
+	// read the token to authorize to a container credentials endpoint with
+	// from
+	ContainerAuthorizationTokenEnvVar string = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+
+	// ContainerAuthorizationTokenFileEnvVar is the environment variable AWS
+	// SDKs read the path of a file holding the token to authorize to a
+	// container credentials endpoint with from
+	ContainerAuthorizationTokenFileEnvVar string = "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"
+
+	// ContainerCredentialsRelativeURIEnvVar is the environment variable AWS
+	// SDKs read the path of an ECS task's credentials endpoint from
+	ContainerCredentialsRelativeURIEnvVar string = "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"
+
+	// WebIdentityTokenFileEnvVar is the environment variable AWS SDKs read
+	// the path of a web identity token to assume a Role with from
+	WebIdentityTokenFileEnvVar string = "AWS_WEB_IDENTITY_TOKEN_FILE"
+
+	// RoleARNEnvVar is the environment variable AWS SDKs read the ARN of the
+	// Role to assume with a web identity token from
+	RoleARNEnvVar string = "AWS_ROLE_ARN"
+
+	// RoleSessionNameEnvVar is the environment variable AWS SDKs read the
+	// session name to assume a Role with a web identity token with from
+	RoleSessionNameEnvVar string = "AWS_ROLE_SESSION_NAME"
+
+	// DefaultServerAddr is the default address the credentials server
+	// listens on, i.e. a random port on the IPv4 loopback interface, which is
+	// the only kind of address AWS SDKs accept plain HTTP endpoints on
+	DefaultServerAddr string = "127.0.0.1:0"
+
+	// DefaultServerExpiryWindow is how long before they expire served
+	// credentials are refreshed
+	DefaultServerExpiryWindow time.Duration = 5 * time.Minute
+
+	// serverTokenSize is the number of random bytes in generated
+	// authorization tokens
+	serverTokenSize int = 32
+)
+
+// credentialSourceEnvVars are the environment variables that AWS SDKs obtain
+// credentials through, which are removed from the environment of subprocesses
+// given credentials some other way so that the SDKs do not prefer them
+var credentialSourceEnvVars = []string{
+	AWSAccessKeyIDEnvVar,
+	AWSSecreteAccessKeyEnvVar,
+	AWSSecurityTokenEnvVar,
+	AWSSessionTokenEnvVar,
+	AWSProfileEnvVar,
+	ContainerCredentialsFullURIEnvVar,
+	ContainerCredentialsRelativeURIEnvVar,
+	ContainerAuthorizationTokenEnvVar,
+	ContainerAuthorizationTokenFileEnvVar,
+	WebIdentityTokenFileEnvVar,
+	RoleARNEnvVar,
+	RoleSessionNameEnvVar,
+}
+
+// ErrUnauthorized is returned to credentials server clients that do not
+// present the authorization token
+var ErrUnauthorized error = errors.New("unauthorized")
+
+// containerCredentials is the document container credentials endpoints
+// respond with
+type containerCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// CredentialsServer serves credentials over HTTP on the loopback interface,
+// speaking the container credentials protocol that AWS SDKs use with
+// AWS_CONTAINER_CREDENTIALS_FULL_URI. Credentials are obtained from a
+// provider and refreshed shortly before they expire, so that clients can keep
+// running for longer than one STS Session.
+type CredentialsServer struct {
+	// provider supplies the served credentials
+	provider aws.CredentialsProvider
+
+	// token authorizes clients
+	token string
+
+	// listener accepts client connections
+	listener net.Listener
+
+	// server serves client requests
+	server *http.Server
+}
+
+// URL returns the URL the server serves credentials at
+func (s *CredentialsServer) URL() string {
+	return "http://" + s.listener.Addr().String() + "/"
+}
+
+// Token returns the token clients have to authorize with
+func (s *CredentialsServer) Token() string { return s.token }
+
+// Env returns the environment variables that point AWS SDKs at the server
+func (s *CredentialsServer) Env() *EnvMap {
+	return NewEnvMap(map[string]string{
+		ContainerCredentialsFullURIEnvVar: s.URL(),
+		ContainerAuthorizationTokenEnvVar: s.Token(),
+	})
+}
+
+// Retrieve returns the served credentials, refreshing them first if they are
+// about to expire
+func (s *CredentialsServer) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return s.provider.Retrieve(ctx)
+}
+
+// Serve serves requests until the server is closed, after which it returns
+// nil
+func (s *CredentialsServer) Serve() error {
+	if err := s.server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the server
+func (s *CredentialsServer) Close() error { return s.server.Close() }
+
+// ServeHTTP responds to a container credentials request
+func (s *CredentialsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.token)) != 1 {
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.Retrieve(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&containerCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		Expiration:      creds.Expires.UTC(),
+	})
+}
+
+var _ http.Handler = (*CredentialsServer)(nil)
+
+// NewCredentialsServerOpts is an option set passed to the credentials server
+// constructor
+type NewCredentialsServerOpts struct {
+	// Provider supplies the served credentials, e.g. a
+	// RoleCredentialsProvider
+	Provider aws.CredentialsProvider
+
+	// Addr is the address to listen on. DefaultServerAddr is used if it is
+	// empty.
+	Addr string
+
+	// Token is the token clients have to authorize with. A random one is
+	// generated if it is empty.
+	Token string
+
+	// ExpiryWindow is how long before they expire credentials are refreshed.
+	// DefaultServerExpiryWindow is used if it is zero.
+	ExpiryWindow time.Duration
+}
+
+// NewCredentialsServer creates a new CredentialsServer listening on the
+// configured address. Serve has to be called for it to respond to requests.
+func NewCredentialsServer(opts *NewCredentialsServerOpts) (*CredentialsServer, error) {
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultServerAddr
+	}
+
+	token := opts.Token
+	if token == "" {
+		tokenBytes := make([]byte, serverTokenSize)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			return nil, fmt.Errorf(ErrGenerateToken, err)
+		}
+
+		token = hex.EncodeToString(tokenBytes)
+	}
+
+	expiryWindow := opts.ExpiryWindow
+	if expiryWindow == 0 {
+		expiryWindow = DefaultServerExpiryWindow
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf(ErrListen, addr, err)
+	}
+
+	s := &CredentialsServer{
+		provider: aws.NewCredentialsCache(opts.Provider, func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = expiryWindow
+		}),
+		token:    token,
+		listener: listener,
+	}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+
+	return s, nil
+}
+
+// ServeExecRole is like ExecRole, but instead of static credentials the
+// subprocess is given the URL of a CredentialsServer serving the Role's
+// credentials, which AWS SDKs refresh from before they expire. Static
+// credentials, the profile selection and other credential sources inherited
+// from the environment, e.g. web identity tokens, are removed, as AWS SDKs
+// prefer them over a credentials server.
+func (c *Config) ServeExecRole(
+	alias string,
+	sessionDuration int32,
+	command string,
+	arguments []string,
+) error {
+	roleEnv, err := c.RoleEnv(alias)
+	if err != nil {
+		return err
+	}
+
+	srv, err := NewCredentialsServer(&NewCredentialsServerOpts{
+		Provider: NewRoleCredentialsProvider(&NewRoleCredentialsProviderOpts{
+			Config:          c,
+			Alias:           alias,
+			SessionDuration: sessionDuration,
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	// Assume the Role up front, so that failures are reported before the
+	// subprocess starts
+	if _, err := srv.Retrieve(context.Background()); err != nil {
+		return err
+	}
+
+	go func() { _ = srv.Serve() }()
+
+	cmdToRun := exec.Command(command, arguments...)
+	cmdToRun.Stdin = os.Stdin
+	cmdToRun.Stdout = os.Stdout
+	cmdToRun.Stderr = os.Stderr
+	cmdToRun.Env = append(environWithout(credentialSourceEnvVars...), roleEnv.StringSlice()...)
+	cmdToRun.Env = append(cmdToRun.Env, srv.Env().StringSlice()...)
+
+	return RunCommand(cmdToRun)
+}
+
+// environWithout returns the environment of the current process without the
+// passed variables
+func environWithout(names ...string) []string {
+	environ := []string{}
+
+	for _, kv := range os.Environ() {
+		excluded := false
+		for _, name := range names {
+			if strings.HasPrefix(kv, name+"=") {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			environ = append(environ, kv)
+		}
+	}
+
+	return environ
+}
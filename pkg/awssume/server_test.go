@@ -0,0 +1,104 @@
+package awssume
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsServer(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	retrievals := 0
+
+	srv, err := NewCredentialsServer(&NewCredentialsServerOpts{
+		Provider: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			retrievals++
+			return aws.Credentials{
+				AccessKeyID:     "AKIAskunk",
+				SecretAccessKey: "secretskunk",
+				SessionToken:    "tokenskunk",
+				CanExpire:       true,
+				Expires:         expires,
+			}, nil
+		}),
+		ExpiryWindow: time.Minute,
+	})
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	go func() { _ = srv.Serve() }()
+
+	assert.True(t, strings.HasPrefix(srv.URL(), "http://127.0.0.1:"))
+	assert.Len(t, srv.Token(), 2*serverTokenSize)
+	assert.ElementsMatch(t, []string{
+		ContainerAuthorizationTokenEnvVar + "=" + srv.Token(),
+		ContainerCredentialsFullURIEnvVar + "=" + srv.URL(),
+	}, srv.Env().StringSlice())
+
+	testCases := []struct {
+		method string
+		token  string
+		status int
+	}{
+		{method: http.MethodGet, token: srv.Token(), status: http.StatusOK},
+		{method: http.MethodGet, token: srv.Token(), status: http.StatusOK},
+		{method: http.MethodGet, token: "badger", status: http.StatusUnauthorized},
+		{method: http.MethodGet, token: "", status: http.StatusUnauthorized},
+		{method: http.MethodPost, token: srv.Token(), status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, srv.URL(), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", tc.token)
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.status, res.StatusCode)
+
+		if tc.status == http.StatusOK {
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, map[string]string{
+				"AccessKeyId":     "AKIAskunk",
+				"SecretAccessKey": "secretskunk",
+				"Token":           "tokenskunk",
+				"Expiration":      expires.Add(-time.Minute).UTC().Format(time.RFC3339),
+			}, body)
+		}
+
+		res.Body.Close()
+	}
+
+	assert.Equal(t, 1, retrievals)
+}
+
+func TestConfigServeExecRole(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: &fakeAssumer{}}, &Role{
+		Alias: "skunk", SessionName: "skunk",
+	})
+
+	t.Setenv(AWSAccessKeyIDEnvVar, "AKIAparent")
+	t.Setenv(AWSProfileEnvVar, "parent")
+	t.Setenv(ContainerCredentialsRelativeURIEnvVar, "/v2/credentials/parent")
+	t.Setenv(ContainerAuthorizationTokenFileEnvVar, "/parent/token")
+	t.Setenv(WebIdentityTokenFileEnvVar, "/parent/web-identity")
+	t.Setenv(RoleARNEnvVar, "arn:aws:iam::000000000000:role/parent")
+
+	assert.NoError(t, cfg.ServeExecRole("skunk", 900, "sh", []string{
+		"-c", `[ -z "$AWS_ACCESS_KEY_ID" ] && [ -z "$AWS_PROFILE" ] && ` +
+			`[ -z "$AWS_CONTAINER_CREDENTIALS_RELATIVE_URI" ] && ` +
+			`[ -z "$AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE" ] && ` +
+			`[ -z "$AWS_WEB_IDENTITY_TOKEN_FILE" ] && [ -z "$AWS_ROLE_ARN" ] && ` +
+			`[ -n "$AWS_CONTAINER_AUTHORIZATION_TOKEN" ] && ` +
+			`case "$AWS_CONTAINER_CREDENTIALS_FULL_URI" in http://127.0.0.1:*) ;; *) exit 1 ;; esac`,
+	}))
+
+	assert.Error(t, cfg.ServeExecRole("badger", 900, "true", nil))
+}
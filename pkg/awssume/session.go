@@ -0,0 +1,164 @@
+package awssume
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	// ErrInvalidSessionName is returned when a session name does not satisfy
+	// STS's length and character rules
+	ErrInvalidSessionName error = errors.New(
+		"session name must be 2-64 characters of letters, digits and +=,.@_-",
+	)
+
+	// ErrInvalidSourceIdentity is returned when a source identity does not
+	// satisfy STS's length and character rules
+	ErrInvalidSourceIdentity error = errors.New(
+		"source identity must be 2-64 characters of letters, digits and +=,.@_- and not start with aws:",
+	)
+)
+
+const (
+	// DefaultSourceIdentity is the source identity template used when one is
+	// requested without specifying it, which names the local user
+	DefaultSourceIdentity string = "{{.User}}"
+
+	// TemplateTimestampFormat is the layout of the {{.Timestamp}} template
+	// value, which only uses characters STS accepts in session names
+	TemplateTimestampFormat string = "20060102T150405Z"
+
+	// sessionNameMinLength is the minimum length STS accepts for a session
+	// name
+	sessionNameMinLength int = 2
+
+	// sessionNameMaxLength is the maximum length STS accepts for a session
+	// name
+	sessionNameMaxLength int = 64
+
+	// sessionNameReplacementChar replaces characters STS does not accept in
+	// session names
+	sessionNameReplacementChar rune = '-'
+
+	// sourceIdentityMinLength is the minimum length STS accepts for a source
+	// identity
+	sourceIdentityMinLength int = 2
+
+	// sourceIdentityMaxLength is the maximum length STS accepts for a source
+	// identity
+	sourceIdentityMaxLength int = 64
+
+	// reservedSourceIdentityPrefix is the prefix STS rejects source
+	// identities starting with
+	reservedSourceIdentityPrefix string = "aws:"
+)
+
+// TemplateData holds the values that Role attribute templates can refer to,
+// e.g. {{.User}}-{{.Host}}-{{.Timestamp}}
+type TemplateData struct {
+	// User is the name of the local user assuming the Role
+	User string
+
+	// Host is the name of the local host
+	Host string
+
+	// Timestamp is the time the Role is assumed at, formatted with
+	// TemplateTimestampFormat. If it is empty, the current time is used.
+	Timestamp string
+}
+
+// NewTemplateData returns the TemplateData describing the passed local user
+// on this host
+func NewTemplateData(u *user.User) *TemplateData {
+	username := u.Username
+
+	// Windows usernames are qualified with a domain, e.g. DOMAIN\user
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+
+	// A missing hostname only leaves {{.Host}} empty
+	host, _ := os.Hostname()
+
+	return &TemplateData{User: username, Host: host}
+}
+
+// ExpandTemplate executes the passed Role attribute template against data
+func ExpandTemplate(text string, data *TemplateData) (string, error) {
+	if data.Timestamp == "" {
+		withTimestamp := *data
+		withTimestamp.Timestamp = time.Now().UTC().Format(TemplateTimestampFormat)
+		data = &withTimestamp
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf(ErrTemplate, text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf(ErrTemplate, text, err)
+	}
+
+	return buf.String(), nil
+}
+
+// SanitizeSessionName makes the passed session name one STS accepts, by
+// replacing unsupported characters and truncating it to 64 characters. Names
+// shorter than the 2 characters STS requires cannot be made acceptable, and
+// are reported as an error.
+func SanitizeSessionName(sessionName string) (string, error) {
+	sanitized := []rune(strings.Map(func(c rune) rune {
+		if isSessionChar(c) {
+			return c
+		}
+
+		return sessionNameReplacementChar
+	}, sessionName))
+
+	if len(sanitized) < sessionNameMinLength {
+		return "", fmt.Errorf(ErrSessionName, sessionName, ErrInvalidSessionName)
+	}
+
+	if len(sanitized) > sessionNameMaxLength {
+		sanitized = sanitized[:sessionNameMaxLength]
+	}
+
+	return string(sanitized), nil
+}
+
+// ValidateSourceIdentity checks that the passed source identity is one STS
+// accepts
+func ValidateSourceIdentity(sourceIdentity string) error {
+	if len(sourceIdentity) < sourceIdentityMinLength ||
+		len(sourceIdentity) > sourceIdentityMaxLength ||
+		strings.HasPrefix(strings.ToLower(sourceIdentity), reservedSourceIdentityPrefix) {
+		return ErrInvalidSourceIdentity
+	}
+
+	for _, c := range sourceIdentity {
+		if !isSessionChar(c) {
+			return ErrInvalidSourceIdentity
+		}
+	}
+
+	return nil
+}
+
+// isSessionChar reports whether c is in the character set STS accepts in
+// session names and source identities, i.e. [\w+=,.@-]
+func isSessionChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.ContainsRune("_+=,.@-", c)
+	}
+}
@@ -0,0 +1,127 @@
+package awssume
+
+import (
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTemplateData(t *testing.T) {
+	testCases := []struct {
+		username string
+		user     string
+	}{
+		{username: "skunk", user: "skunk"},
+		{username: `CORP\skunk`, user: "skunk"},
+	}
+
+	host, err := os.Hostname()
+	assert.NoError(t, err)
+
+	for _, tc := range testCases {
+		data := NewTemplateData(&user.User{Username: tc.username})
+		assert.Equal(t, tc.user, data.User)
+		assert.Equal(t, host, data.Host)
+		assert.Empty(t, data.Timestamp)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	testCases := []struct {
+		text        string
+		expanded    string
+		errExpected bool
+	}{
+		{text: "static", expanded: "static"},
+		{text: "{{.User}}", expanded: "skunk"},
+		{text: "ci-{{.User}}", expanded: "ci-skunk"},
+		{
+			text:     "{{.User}}-{{.Host}}-{{.Timestamp}}",
+			expanded: "skunk-burrow.local-20200102T030405Z",
+		},
+		{text: "{{.Missing}}", errExpected: true},
+		{text: "{{.User", errExpected: true},
+	}
+
+	for _, tc := range testCases {
+		expanded, err := ExpandTemplate(tc.text, &TemplateData{
+			User:      "skunk",
+			Host:      "burrow.local",
+			Timestamp: "20200102T030405Z",
+		})
+		if tc.errExpected {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.expanded, expanded)
+	}
+}
+
+func TestExpandTemplateTimestamp(t *testing.T) {
+	expanded, err := ExpandTemplate("{{.Timestamp}}", &TemplateData{})
+	assert.NoError(t, err)
+
+	timestamp, err := time.Parse(TemplateTimestampFormat, expanded)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), timestamp, time.Minute)
+}
+
+func TestSanitizeSessionName(t *testing.T) {
+	testCases := []struct {
+		sessionName string
+		sanitized   string
+		errExpected bool
+	}{
+		{sessionName: "skunk", sanitized: "skunk"},
+		{sessionName: "skunk@example.com", sanitized: "skunk@example.com"},
+		{sessionName: "skunk badger/ferret", sanitized: "skunk-badger-ferret"},
+		{sessionName: "skünk", sanitized: "sk-nk"},
+		{sessionName: strings.Repeat("s", 70), sanitized: strings.Repeat("s", 64)},
+		{sessionName: "ab", sanitized: "ab"},
+		{sessionName: "a", errExpected: true},
+		{sessionName: "", errExpected: true},
+	}
+
+	for _, tc := range testCases {
+		sanitized, err := SanitizeSessionName(tc.sessionName)
+		if tc.errExpected {
+			assert.ErrorIs(t, err, ErrInvalidSessionName)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.sanitized, sanitized)
+	}
+}
+
+func TestValidateSourceIdentity(t *testing.T) {
+	testCases := []struct {
+		sourceIdentity string
+		errExpected    bool
+	}{
+		{sourceIdentity: "skunk", errExpected: false},
+		{sourceIdentity: "skunk@example.com", errExpected: false},
+		{sourceIdentity: "a_b+c=d,e.f-g", errExpected: false},
+		{sourceIdentity: "s", errExpected: true},
+		{sourceIdentity: strings.Repeat("s", 65), errExpected: true},
+		{sourceIdentity: "skunk badger", errExpected: true},
+		{sourceIdentity: "skunk/badger", errExpected: true},
+		{sourceIdentity: "aws:skunk", errExpected: true},
+		{sourceIdentity: "AWS:skunk", errExpected: true},
+	}
+
+	for _, tc := range testCases {
+		err := ValidateSourceIdentity(tc.sourceIdentity)
+		if tc.errExpected {
+			assert.ErrorIs(t, err, ErrInvalidSourceIdentity)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package awssume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupportedShell is returned when export statements are requested
+	// for a shell dialect that is not supported
+	ErrUnsupportedShell error = errors.New("unsupported shell")
+
+	// ErrShellNesting is returned when a shell is requested from within a
+	// shell already started by ShellRole
+	ErrShellNesting error = errors.New("refusing to nest Role shells")
+
+	// ErrInvalidEnvVarName is returned when an environment variable name is
+	// not made of letters, digits and underscores, or starts with a digit
+	ErrInvalidEnvVarName error = errors.New(
+		"environment variable names must be letters, digits and underscores, not starting with a digit",
+	)
+)
+
+const (
+	// RoleEnvVar is the environment variable holding the alias of the Role
+	// whose credentials a shell started by ShellRole has
+	RoleEnvVar string = "AWSSUME_ROLE"
+
+	// ExpirationEnvVar is the environment variable holding the time, in
+	// RFC 3339 format, at which the credentials of a shell started by
+	// ShellRole expire
+	ExpirationEnvVar string = "AWSSUME_EXPIRATION"
+
+	// shellPromptPrefix is prepended to the prompt of shells started by
+	// ShellRole, and is expanded by the shell itself
+	shellPromptPrefix string = "(awssume:$" + RoleEnvVar + ") "
+)
+
+// ShellDialect describes the shells export statements can be rendered for
+type ShellDialect int
+
+const (
+	// Bash //
+	Bash ShellDialect = iota
+
+	// Zsh //
+	Zsh
+
+	// Fish //
+	Fish
+
+	// PowerShell //
+	PowerShell
+
+	// UnknownShell //
+	UnknownShell
+)
+
+// FromName creates a ShellDialect from a shell name or executable path
+func (sd *ShellDialect) FromName(name string) {
+	switch strings.TrimSuffix(strings.ToLower(path.Base(name)), ".exe") {
+	case "bash", "sh":
+		*sd = Bash
+	case "zsh":
+		*sd = Zsh
+	case "fish":
+		*sd = Fish
+	case "powershell", "pwsh":
+		*sd = PowerShell
+	default:
+		*sd = UnknownShell
+	}
+}
+
+// String returns the name of the shell dialect
+func (sd ShellDialect) String() string {
+	switch sd {
+	case Bash:
+		return "bash"
+	case Zsh:
+		return "zsh"
+	case Fish:
+		return "fish"
+	case PowerShell:
+		return "powershell"
+	case UnknownShell:
+		return "UNKNOWN"
+	default:
+		return ""
+	}
+}
+
+// Export returns the statement that exports the passed environment variable
+// in the shell dialect, with the value quoted so that it is taken literally.
+// Names are not quoted, so ones that are not valid environment variable names
+// are rejected.
+func (sd ShellDialect) Export(name, value string) (string, error) {
+	if err := ValidateEnvVarName(name); err != nil {
+		return "", err
+	}
+
+	switch sd {
+	case Bash, Zsh:
+		return "export " + name + "='" +
+			strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+	case Fish:
+		return "set -gx " + name + " '" +
+			strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'", nil
+	case PowerShell:
+		return "$Env:" + name + " = '" +
+			strings.ReplaceAll(value, "'", "''") + "'", nil
+	default:
+		return "", ErrUnsupportedShell
+	}
+}
+
+// ValidateEnvVarName checks that the passed environment variable name is made
+// of letters, digits and underscores, and does not start with a digit
+func ValidateEnvVarName(name string) error {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return fmt.Errorf(ErrEnvVarName, name, ErrInvalidEnvVarName)
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return fmt.Errorf(ErrEnvVarName, name, ErrInvalidEnvVarName)
+		}
+	}
+
+	return nil
+}
+
+// ValidateEnv checks that the names of the passed environment variables are
+// valid environment variable names, reporting the first invalid one in name
+// order
+func ValidateEnv(env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := ValidateEnvVarName(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShellExports returns the statements that export the environment variables
+// in the passed shell dialect, ordered by variable name
+func (e *EnvMap) ShellExports(sd ShellDialect) ([]string, error) {
+	names := make([]string, 0, len(e.m))
+	for k := range e.m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	exports := make([]string, len(names))
+	for i, name := range names {
+		export, err := sd.Export(name, e.m[name])
+		if err != nil {
+			return nil, err
+		}
+
+		exports[i] = export
+	}
+
+	return exports, nil
+}
+
+// ShellRoleOpts is an option set passed to ShellRole
+type ShellRoleOpts struct {
+	// Shell is the shell to start. If it is empty, GetShell is used.
+	Shell string
+
+	// Force allows starting a shell from within a shell already started by
+	// ShellRole
+	Force bool
+
+	// Prompt prefixes the prompt of bash, zsh and fish shells with the alias
+	// of the assumed Role
+	Prompt bool
+}
+
+// ShellRole starts an interactive shell with the credentials of the target
+// Role exposed as environment variables, along with the Role's environment,
+// its alias and the credentials' expiration. If the shell does not exit
+// successfully, an *ExitError describing how it terminated is returned.
+func (c *Config) ShellRole(alias string, sessionDuration int32, opts *ShellRoleOpts) error {
+	if current := os.Getenv(RoleEnvVar); current != "" && !opts.Force {
+		return fmt.Errorf(ErrNestedShell, current, ErrShellNesting)
+	}
+
+	shell := opts.Shell
+	if shell == "" {
+		var err error
+		if shell, err = GetShell(); err != nil {
+			return err
+		}
+	}
+
+	roleEnv, err := c.RoleEnv(alias)
+	if err != nil {
+		return err
+	}
+
+	creds, err := c.AssumeRole(alias, sessionDuration)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), roleEnv.StringSlice()...)
+	env = append(env, NewCredentialsEnvMap(creds).StringSlice()...)
+	env = append(env, RoleEnvVar+"="+alias)
+	if creds.CanExpire {
+		env = append(env, ExpirationEnvVar+"="+creds.Expires.UTC().Format(time.RFC3339))
+	}
+
+	var arguments []string
+	if opts.Prompt {
+		dir, err := os.MkdirTemp("", "awssume")
+		if err != nil {
+			return fmt.Errorf(ErrCreatingFile, err)
+		}
+		defer os.RemoveAll(dir)
+
+		var promptEnv []string
+		if arguments, promptEnv, err = shellPromptSetup(shell, dir); err != nil {
+			return err
+		}
+
+		env = append(env, promptEnv...)
+	}
+
+	cmdToRun := exec.Command(shell, arguments...)
+	cmdToRun.Stdin = os.Stdin
+	cmdToRun.Stdout = os.Stdout
+	cmdToRun.Stderr = os.Stderr
+	cmdToRun.Env = env
+
+	return RunCommand(cmdToRun)
+}
+
+// shellPromptSetup writes any startup files needed to prefix the prompt of
+// the passed shell into dir, returning the arguments and environment
+// variables that make the shell use them. Shells whose prompt cannot be
+// changed are started as-is.
+func shellPromptSetup(shell, dir string) ([]string, []string, error) {
+	writeFile := func(name, contents string) (string, error) {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte(contents), 0o600); err != nil {
+			return "", fmt.Errorf(ErrWritingToFile, filePath, err)
+		}
+
+		return filePath, nil
+	}
+
+	switch strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe") {
+	case "bash":
+		rcFile, err := writeFile(".bashrc", strings.Join([]string{
+			`[ -f ~/.bashrc ] && . ~/.bashrc`,
+			`PS1="` + shellPromptPrefix + `$PS1"`,
+		}, "\n")+"\n")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []string{"--rcfile", rcFile}, nil, nil
+	case "zsh":
+		// zsh reads its startup files from $ZDOTDIR, so it is pointed at dir
+		// and the startup files there hand over to the user's own. .zshrc
+		// restores the user's $ZDOTDIR, so the user's .zlogin is read from
+		// there directly, and the one in dir only runs for login shells that
+		// are not interactive.
+		userDir := os.Getenv("ZDOTDIR")
+		if userDir == "" {
+			userDir, _ = os.UserHomeDir()
+		}
+
+		restoreDir, _ := Bash.Export("ZDOTDIR", userDir)
+		overrideDir, _ := Bash.Export("ZDOTDIR", dir)
+
+		if _, err := writeFile(".zshenv", strings.Join([]string{
+			restoreDir,
+			`[ -f "$ZDOTDIR/.zshenv" ] && . "$ZDOTDIR/.zshenv"`,
+			`__awssume_zdotdir="$ZDOTDIR"`,
+			overrideDir,
+		}, "\n")+"\n"); err != nil {
+			return nil, nil, err
+		}
+
+		if _, err := writeFile(".zprofile", strings.Join([]string{
+			`ZDOTDIR="$__awssume_zdotdir"`,
+			`[ -f "$ZDOTDIR/.zprofile" ] && . "$ZDOTDIR/.zprofile"`,
+			`__awssume_zdotdir="$ZDOTDIR"`,
+			overrideDir,
+		}, "\n")+"\n"); err != nil {
+			return nil, nil, err
+		}
+
+		if _, err := writeFile(".zshrc", strings.Join([]string{
+			`ZDOTDIR="$__awssume_zdotdir"`,
+			`unset __awssume_zdotdir`,
+			`[ -f "$ZDOTDIR/.zshrc" ] && . "$ZDOTDIR/.zshrc"`,
+			`PROMPT="` + shellPromptPrefix + `$PROMPT"`,
+		}, "\n")+"\n"); err != nil {
+			return nil, nil, err
+		}
+
+		if _, err := writeFile(".zlogin", strings.Join([]string{
+			`ZDOTDIR="$__awssume_zdotdir"`,
+			`unset __awssume_zdotdir`,
+			`[ -f "$ZDOTDIR/.zlogin" ] && . "$ZDOTDIR/.zlogin"`,
+		}, "\n")+"\n"); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, []string{"ZDOTDIR=" + dir}, nil
+	case "fish":
+		return []string{"--init-command", strings.Join([]string{
+			`functions -q fish_prompt; and functions -c fish_prompt __awssume_fish_prompt`,
+			`function fish_prompt; printf '(awssume:%s) ' $` + RoleEnvVar +
+				`; functions -q __awssume_fish_prompt; and __awssume_fish_prompt; end`,
+		}, "; ")}, nil, nil
+	default:
+		return nil, nil, nil
+	}
+}
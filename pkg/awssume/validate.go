@@ -0,0 +1,253 @@
+package awssume
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrEmptyAlias is returned when a Role has no alias
+	ErrEmptyAlias error = errors.New("alias is empty")
+
+	// ErrMissingARN is returned when a Role has no ARN
+	ErrMissingARN error = errors.New("ARN is missing")
+
+	// ErrNotRoleARN is returned when a Role's ARN does not name an IAM Role
+	ErrNotRoleARN error = errors.New("ARN is not an IAM Role ARN")
+
+	// ErrUnknownSourceRole is returned when a Role's source Role is not
+	// configured
+	ErrUnknownSourceRole error = errors.New("source Role is not configured")
+)
+
+// iamRoleResourcePrefix prefixes the resource of IAM Role ARNs
+const iamRoleResourcePrefix string = "role/"
+
+// validationTemplateData is the TemplateData templates are expanded with when
+// they are validated
+var validationTemplateData *TemplateData = &TemplateData{
+	User:      "user",
+	Host:      "host",
+	Timestamp: TemplateTimestampFormat,
+}
+
+// ValidationError describes a problem with an attribute of a configured Role
+type ValidationError struct {
+	// Index is the position of the Role in the configuration
+	Index int
+
+	// Alias is the alias of the Role
+	Alias string
+
+	// Field is the configuration key of the attribute, e.g. session_name
+	Field string
+
+	// Line is the line of the attribute in the configuration file, or 0 if
+	// it is not known
+	Line int
+
+	// Err is the problem with the attribute
+	Err error
+}
+
+// Error describes the problem along with where it is in the configuration
+func (e *ValidationError) Error() string {
+	location := fmt.Sprintf("roles[%d]", e.Index)
+	if e.Alias != "" {
+		location += " (" + e.Alias + ")"
+	}
+
+	if e.Line > 0 {
+		location += fmt.Sprintf(" line %d", e.Line)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Err)
+}
+
+// Unwrap returns the problem with the attribute
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+var _ error = (*ValidationError)(nil)
+
+// Validate returns the problems with the configured Roles that would prevent
+// them from being assumed, in configuration order. Lines are only known for
+// YAML configuration files that were not migrated or changed since they were
+// loaded.
+func (c *Config) Validate() []*ValidationError {
+	problems := []*ValidationError{}
+	lines := c.roleLines()
+	aliases := map[string]bool{}
+
+	for i, r := range c.Roles {
+		report := func(field string, err error) {
+			p := &ValidationError{Index: i, Alias: r.GetAlias(), Field: field, Err: err}
+			if i < len(lines) {
+				p.Line = lines[i][field]
+				if p.Line == 0 {
+					p.Line = lines[i][""]
+				}
+			}
+
+			problems = append(problems, p)
+		}
+
+		switch alias := r.GetAlias(); {
+		case alias == "":
+			report("alias", ErrEmptyAlias)
+		case aliases[alias]:
+			report("alias", ErrAliasTaken)
+		default:
+			aliases[alias] = true
+		}
+
+		if err := validateRoleARN(r.GetARN()); err != nil {
+			report("arn", err)
+		}
+
+		if err := validateSessionName(r.GetSessionName()); err != nil {
+			report("session_name", err)
+		}
+
+		if source := r.GetSourceRole(); source != "" {
+			if _, err := c.GetRoleByAlias(source); err != nil {
+				report("source", ErrUnknownSourceRole)
+			} else if _, err := c.GetRoleChain(r.GetAlias()); err != nil {
+				report("source", err)
+			}
+		}
+
+		for _, k := range r.GetTransitiveTagKeys() {
+			if _, ok := r.GetTags()[k]; !ok {
+				report("transitive_tag_keys", fmt.Errorf(ErrTransitiveTagKey, k))
+			}
+		}
+
+		if policy := r.GetPolicy(); policy != "" {
+			if _, err := CompactPolicy(policy); err != nil {
+				report("policy", err)
+			}
+		}
+
+		if err := ValidatePolicyARNs(r.GetPolicyARNs()); err != nil {
+			report("policy_arns", err)
+		}
+
+		if err := validateSourceIdentity(r.GetSourceIdentity()); err != nil {
+			report("source_identity", err)
+		}
+
+		if sessionDuration := r.GetSessionDuration(); sessionDuration != 0 {
+			if err := ValidateSessionDuration(sessionDuration); err != nil {
+				report("session_duration", err)
+			} else if r.GetSourceRole() != "" && sessionDuration > MaxChainedSessionDuration {
+				report("session_duration", fmt.Errorf(
+					ErrSessionDuration, sessionDuration, ErrChainedSessionDuration,
+				))
+			}
+		}
+
+		if err := ValidateEnv(r.GetEnv()); err != nil {
+			report("env", err)
+		}
+	}
+
+	return problems
+}
+
+// validateRoleARN checks that the passed ARN names an IAM Role
+func validateRoleARN(roleARN *ARN) error {
+	if roleARN == nil || roleARN.ARN == nil {
+		return ErrMissingARN
+	}
+
+	if roleARN.Service != "iam" || !strings.HasPrefix(roleARN.Resource, iamRoleResourcePrefix) {
+		return ErrNotRoleARN
+	}
+
+	return nil
+}
+
+// validateSessionName checks that the passed session name is one STS
+// accepts. Templates are only checked for whether they can be expanded,
+// since their expansions are sanitized when the Role is assumed.
+func validateSessionName(sessionName string) error {
+	if strings.Contains(sessionName, "{{") {
+		_, err := ExpandTemplate(sessionName, validationTemplateData)
+		return err
+	}
+
+	if len(sessionName) < sessionNameMinLength || len(sessionName) > sessionNameMaxLength {
+		return ErrInvalidSessionName
+	}
+
+	for _, c := range sessionName {
+		if !isSessionChar(c) {
+			return ErrInvalidSessionName
+		}
+	}
+
+	return nil
+}
+
+// validateSourceIdentity checks that the passed source identity template, if
+// any, can be expanded, and that it is one STS accepts if it is not a
+// template
+func validateSourceIdentity(sourceIdentity string) error {
+	if sourceIdentity == "" {
+		return nil
+	}
+
+	if strings.Contains(sourceIdentity, "{{") {
+		_, err := ExpandTemplate(sourceIdentity, validationTemplateData)
+		return err
+	}
+
+	return ValidateSourceIdentity(sourceIdentity)
+}
+
+// roleLines returns, for every Role in the configuration file, the lines of
+// its attributes by key, with the line the Role starts on under the empty
+// key. It returns nil if the lines are not known.
+func (c *Config) roleLines() []map[string]int {
+	if c.GetFormat() != YAML || c.source == nil {
+		return nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(c.source, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var roles *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "roles" {
+			roles = root.Content[i+1]
+		}
+	}
+
+	if roles == nil || roles.Kind != yaml.SequenceNode || len(roles.Content) != len(c.Roles) {
+		return nil
+	}
+
+	lines := make([]map[string]int, len(roles.Content))
+	for i, role := range roles.Content {
+		lines[i] = map[string]int{"": role.Line}
+		if role.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for j := 0; j+1 < len(role.Content); j += 2 {
+			lines[i][role.Content[j].Value] = role.Content[j].Line
+		}
+	}
+
+	return lines
+}
